@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gitPatch returns the diff turning a into b in the format of git diff, so
+// that it can be applied with git apply, or nothing if they are equal.
+// Absolute names are made relative to the working directory.
+func gitPatch(name string, a, b []byte) []byte {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+	mode := gitMode(name)
+	if filepath.IsAbs(name) {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, name); err == nil {
+				name = rel
+			}
+		}
+	}
+	name = strings.TrimPrefix(filepath.ToSlash(name), "./")
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "diff --git a/%s b/%s\n", name, name)
+	fmt.Fprintf(&out, "index %.7s..%.7s %s\n", blobHash(a), blobHash(b), mode)
+	out.Write(unifiedDiff("a/"+name, "b/"+name, a, b))
+	return out.Bytes()
+}
+
+// gitMode returns the mode git records for the file fname, that of a
+// regular file if it cannot be read, e.g. for stdin
+func gitMode(fname string) string {
+	info, err := os.Stat(fname)
+	if err == nil && info.Mode()&0o111 != 0 {
+		return "100755"
+	}
+	return "100644"
+}
+
+// blobHash returns the object name git gives to a file with contents b
+func blobHash(b []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(b))
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// diffContext is the number of unchanged lines around each hunk
+const diffContext = 3
+
+// diffLine is a line of a diff, kind is ' ', '-' or '+'
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// unifiedDiff returns the unified diff turning a into b, with the names of
+// both sides in the headers, or nothing if they are equal
+func unifiedDiff(from, to string, a, b []byte) []byte {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	// line numbers in a and b before each line of the diff
+	aLine, bLine := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for i, l := range lines {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if l.kind != '+' {
+			aLine[i+1]++
+		}
+		if l.kind != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", from, to)
+	for i := 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// extend the hunk while changes are close enough to share context
+		start, end := i-diffContext, i
+		if start < 0 {
+			start = 0
+		}
+		for j := i; j < len(lines); j++ {
+			if lines[j].kind != ' ' {
+				end = j
+			} else if j-end > 2*diffContext {
+				break
+			}
+		}
+		stop := end + diffContext + 1
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(aLine[start], aLine[stop]-aLine[start]),
+			hunkRange(bLine[start], bLine[stop]-bLine[start]))
+		for _, l := range lines[start:stop] {
+			out.WriteByte(l.kind)
+			out.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = stop
+	}
+	return out.Bytes()
+}
+
+// hunkRange formats the start line and count of one side of a hunk. Empty
+// ranges start at the line before them.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits b after every new line
+func splitLines(b []byte) []string {
+	lines := strings.SplitAfter(string(b), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the shortest edit script turning a into b, using the
+// Myers algorithm
+func diffLines(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+
+	// step d only reads the diagonals -d-1 to d+1 of the previous one, so
+	// only those are kept for backtracking
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int{}, v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrack walks the trace of diffLines back from the end of both inputs.
+// Diagonal k of step d is at trace[d][k+d+1].
+func backtrack(a, b []string, trace [][]int) []diffLine {
+	var (
+		lines []diffLine
+		x, y  = len(a), len(b)
+	)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v, offset := trace[d], d+1
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			lines = append(lines, diffLine{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				lines = append(lines, diffLine{'+', b[y-1]})
+			} else {
+				lines = append(lines, diffLine{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/td0m/go-order/order"
+)
+
+// runTests runs the tests of the package in dir. It is a variable so tests
+// can replace it.
+var runTests = func(dir string) error {
+	cmd := exec.Command("go", "test", ".")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("go test failed: %w\n%s", err, out)
+	}
+	return nil
+}
+
+// writeFileTested sorts and writes fname like writeFile, then runs the tests
+// of its package and restores the original contents if they fail
+func writeFileTested(fname string, contents []byte, config order.Config) error {
+	if _, err := exec.LookPath("go"); err != nil {
+		return fmt.Errorf("cannot verify tests without the go toolchain: %w", err)
+	}
+
+	if err := writeFile(fname, contents, config); err != nil {
+		return err
+	}
+
+	if err := runTests(filepath.Dir(fname)); err != nil {
+		if werr := replaceFile(fname, nil, contents); werr != nil {
+			return fmt.Errorf("failed to restore %s after failing tests: %w", fname, werr)
+		}
+		return fmt.Errorf("restored %s: %w", fname, err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/td0m/go-order/order"
+)
+
+// orderLock records the order of the declarations of every file, by key,
+// see declKey. Files are listed by lockKey.
+type orderLock map[string][]string
+
+// readLock reads the lock file at fname, a missing file is an empty lock
+func readLock(fname string) (orderLock, error) {
+	b, err := os.ReadFile(fname)
+	if errors.Is(err, fs.ErrNotExist) {
+		return orderLock{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock: %w", err)
+	}
+
+	lock := orderLock{}
+	if err := json.Unmarshal(b, &lock); err != nil {
+		return nil, fmt.Errorf("invalid lock %s: %w", fname, err)
+	}
+	return lock, nil
+}
+
+func writeLock(fname string, lock orderLock) error {
+	b, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(fname, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write lock: %w", err)
+	}
+	return nil
+}
+
+// sortLocked sorts fname in the order recorded in the lock file, writing
+// the result to w or, with -w, back to the file. The lock is only updated
+// along with the file, when declarations were added or removed.
+func sortLocked(w io.Writer, lockFile, fname string, contents []byte, config order.Config) error {
+	lock, err := readLock(lockFile)
+	if err != nil {
+		return err
+	}
+	key := lockKey(lockFile, fname)
+
+	config.LockedOrder = lock[key]
+	var buf bytes.Buffer
+	if err := order.OrderTo(&buf, contents, config); err != nil {
+		return fmt.Errorf("sortFile failed: %w", err)
+	}
+
+	if !config.WriteToFile {
+		_, err = w.Write(buf.Bytes())
+		return err
+	}
+	if err := replaceFile(fname, contents, buf.Bytes()); err != nil {
+		return err
+	}
+
+	keys, err := order.DeclOrder(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if equalKeys(keys, lock[key]) {
+		return nil
+	}
+	lock[key] = keys
+	return writeLock(lockFile, lock)
+}
+
+// lockKey returns the key of fname in the lock file: its path relative to
+// the directory of the lock file, so that it does not depend on how the
+// file was named on the command line
+func lockKey(lockFile, fname string) string {
+	key := filepath.Clean(fname)
+	dir, err := filepath.Abs(filepath.Dir(lockFile))
+	if err != nil {
+		return filepath.ToSlash(key)
+	}
+	abs, err := filepath.Abs(fname)
+	if err != nil {
+		return filepath.ToSlash(key)
+	}
+	if rel, err := filepath.Rel(dir, abs); err == nil {
+		key = rel
+	}
+	return filepath.ToSlash(key)
+}
+
+func equalKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -2,158 +2,383 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"flag"
 	"fmt"
-	"go/ast"
-	"go/parser"
-	"go/token"
 	"io"
 	"os"
-	"reflect"
-	"sort"
+	"path/filepath"
+	"regexp"
+	"runtime"
 	"strings"
+
+	"github.com/td0m/go-order/order"
 )
 
-var order = map[token.Token]int{
-	token.IMPORT: 0,
-	token.CONST:  1,
-	token.VAR:    2,
-	token.TYPE:   3,
-	token.FUNC:   4,
+// readNames reads one name per line, skipping blank lines and # comments
+func readNames(r io.Reader) ([]string, error) {
+	var names []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read names: %w", err)
+	}
+	return names, nil
 }
 
-type Config struct {
-	SortAlphabetically bool
-	WriteToFile bool
+// singleFileFlags are the flags only handled when sorting a single file or
+// stdin
+var singleFileFlags = []string{
+	"patch", "audit-todos", "emit-script", "apply-script", "html",
+	"github-suggestions", "report-pairings", "order-lock", "complexity",
+	"lint-shadows", "comment-report",
 }
 
-type funcOrMethod struct {
-	name string
-	recv string
-}
+// run is the command line, parsing its flags from args
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var (
+		config  order.Config
+		help    bool
+		patch   string
+		align   bool
+		audit   bool
+		cyclo   bool
+		shadows bool
+		placed  bool
+		suggest bool
+		pairs   bool
+		lock    string
+		schema  bool
+		recurse bool
+		jobs    int
+		list    bool
+		diff    bool
+		check   bool
+		format  string
+		emit    bool
+		apply   string
+		planOut string
+		planIn  string
+		tax     string
+		kinds   string
+		report  string
+		routes  string
+		renames string
+		tests   bool
+		outDir  string
+	)
 
-func assignRootCommentsToDecl(tree *ast.File, content []byte) map[ast.Decl][]byte {
-	comments := map[ast.Decl][]byte{
-		nil: {'\n'},
+	fs := flag.NewFlagSet("go-order", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.BoolVar(&help, "h", false, "help")
+	fs.BoolVar(&list, "l", false, "list files whose order differs instead of sorting, exit 1 if stdin does")
+	fs.BoolVar(&check, "check", false, "write nothing, list unsorted files on stderr and exit 1 if there are any")
+	fs.BoolVar(&diff, "d", false, "print a unified diff of the changes instead of sorting")
+	fs.StringVar(&format, "format", "", "print the changes instead of sorting: diff, like -d, or patch, for git apply")
+	fs.BoolVar(&recurse, "r", false, "sort every .go file below the directory given as the argument")
+	fs.IntVar(&jobs, "j", runtime.GOMAXPROCS(0), "number of files to sort at once with -r or several files")
+	fs.BoolVar(&config.SortAlphabetically, "a", false, "sort alphabetically")
+	fs.BoolVar(&config.ExportedFirst, "exported-first", false, "list exported declarations before unexported ones of the same kind")
+	fs.StringVar(&kinds, "order", "", "order of the declaration kinds, e.g. import,type,const,var,func")
+	fs.BoolVar(&config.WriteToFile, "w", false, "write sorted output back to the file, or to the target of a symlink")
+	fs.BoolVar(&config.MirrorEmbeddedOrder, "mirror-embedded", false, "order overriding methods like the methods of the embedded type")
+	fs.BoolVar(&config.IncludeIgnored, "include-ignored", false, "also sort files with a //go:build ignore constraint")
+	fs.BoolVar(&config.IncludeGenerated, "include-generated", false, "also sort files marked with a // Code generated ... DO NOT EDIT. comment")
+	fs.StringVar(&config.MethodsByCallOrder, "call-order", "", "list the methods called by this method in call order, e.g. Run")
+	fs.BoolVar(&config.DeprecatedMethodsLast, "deprecated-last", false, "list deprecated methods last within their receiver")
+	fs.BoolVar(&config.SentinelErrorsFirst, "errors-first", false, "list sentinel errors (ErrXxx = errors.New(...)) before other vars")
+	fs.BoolVar(&config.InterfacesFirst, "interfaces-first", false, "list interfaces before other types")
+	fs.BoolVar(&config.TypesWithMethodsFirst, "methods-first", false, "list types with methods before types without")
+	fs.BoolVar(&config.MocksAfterInterface, "mocks-after", false, "list MockX, FakeX and StubX types right after X")
+	fs.BoolVar(&config.GenericFuncsLast, "generics-last", false, "list generic functions after other functions")
+	fs.StringVar(&config.SameNameTiebreak, "same-name", order.MethodFirst, "where a function sharing its name with a method goes: method-first or func-first")
+	fs.BoolVar(&config.PreserveBuilderOrder, "builder-order", false, "keep fluent builder methods first, in source order")
+	fs.BoolVar(&config.ContractMethodsFirst, "contract-first", false, "list methods implementing an interface first, in its order")
+	fs.BoolVar(&config.MainPackageOrdering, "main-package-ordering", false, "list init first outside of package main")
+	fs.BoolVar(&config.BookendMethods, "bookend", false, "list setup methods first and Close, Shutdown and Stop last within their receiver")
+	fs.BoolVar(&config.ContextVariantsAdjacent, "context-adjacent", false, "list XContext variants right after X")
+	fs.BoolVar(&config.ConstructorsWithType, "constructors-with-type", false, "list NewFoo constructors right below type Foo")
+	fs.BoolVar(&config.GroupMethodsWithType, "methods-with-type", false, "list the methods of each type right below it")
+	fs.BoolVar(&config.MethodsByField, "by-field", false, "group methods by the receiver field they touch, in field order")
+	fs.BoolVar(&config.PairInitWithVar, "init-with-var", false, "keep init functions right after the vars they populate")
+	fs.BoolVar(&config.GroupVarsByType, "group-vars", false, "group vars by their declared type")
+	fs.BoolVar(&config.MethodOrderFromInterface, "interface-order", false, "order methods implementing an interface like the interface")
+	fs.BoolVar(&config.TypeAliasesLast, "aliases-last", false, "list type aliases after other types")
+	fs.BoolVar(&config.NormalizeImports, "merge-imports", false, "merge separate import declarations into one block")
+	fs.BoolVar(&config.Strict, "strict", false, "fail on inconsistent receiver names")
+	fs.BoolVar(&config.AssertAPIStable, "assert-api-stable", false, "fail if sorting would change the exported API")
+	fs.BoolVar(&config.Verify, "verify", false, "with -w, check that no declaration changed before writing")
+	fs.BoolVar(&config.SortDirectives, "sort-directives", false, "list //go: and then //nolint directives after the doc text")
+	fs.BoolVar(&config.SortImports, "sort-imports", false, "sort import specs by path")
+	fs.BoolVar(&config.MergeImportGroups, "merge-import-groups", false, "sort import blocks as a single group")
+	fs.BoolVar(&config.GroupImports, "group-imports", false, "group imports into standard library and other packages")
+	fs.StringVar(&config.LocalImportPrefix, "local", "", "with -group-imports, put imports with this prefix into a group of their own")
+	fs.BoolVar(&config.BlankImportsLast, "blank-imports-last", false, "group blank identifier imports at the bottom of the import block")
+	fs.BoolVar(&config.SortSpecs, "sort-specs", false, "sort specs within const, var and type blocks")
+	fs.BoolVar(&config.DocumentedSpecsFirst, "documented-first", false, "sort specs within blocks, commented ones first")
+	fs.BoolVar(&config.SortStructFields, "sort-fields", false, "sort struct fields by name, embedded fields first")
+	fs.BoolVar(&config.SortInterfaceMethods, "sort-interface-methods", false, "sort interface methods by name, embedded interfaces first")
+	fs.BoolVar(&config.NormalizeBuildTags, "normalize-build-tags", false, "sort the operands of //go:build and // +build lines")
+	fs.BoolVar(&config.TemplateMode, "template-mode", false, "tolerate {{ }} template placeholders, e.g. in .go.tmpl files")
+	fs.BoolVar(&config.UsePrinter, "printer", false, "print declarations with go/printer instead of copying their source")
+	fs.BoolVar(&config.PreserveSpacing, "preserve-spacing", false, "keep tightly packed declarations packed and the blank lines after others")
+	fs.IntVar(&config.BlankLinesBetweenReceivers, "receiver-spacing", 0, "blank lines between the method blocks of different receivers, 0 for one")
+	fs.Float64Var(&config.DisorderThreshold, "disorder-threshold", 0, "only sort files where more than this fraction, 0 to 1, of the declarations would move")
+	fs.BoolVar(&config.Gofmt, "fmt", false, "gofmt the sorted output")
+	fs.Func("sticky", "comma separated comment prefixes that always move with the declaration below", func(s string) error {
+		for _, prefix := range strings.Split(s, ",") {
+			if prefix = strings.TrimSpace(prefix); prefix != "" {
+				config.StickyCommentPrefixes = append(config.StickyCommentPrefixes, prefix)
+			}
+		}
+		return nil
+	})
+	fs.Func("sort-key", "comma separated comparators for names, in order: natural, case-insensitive, export", func(s string) error {
+		for _, key := range strings.Split(s, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				config.SortKey = append(config.SortKey, key)
+			}
+		}
+		return nil
+	})
+	fs.Func("doc-tags", "comma separated doc comment tags, e.g. API,internal, to group declarations by", func(s string) error {
+		for _, tag := range strings.Split(s, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				config.DocTagOrder = append(config.DocTagOrder, tag)
+			}
+		}
+		return nil
+	})
+	fs.Func("priority-pattern", "regular expression for method names to list first for each receiver, e.g. ^Handle", func(s string) error {
+		if _, err := regexp.Compile(s); err != nil {
+			return err
+		}
+		config.PriorityMethodPattern = s
+		return nil
+	})
+	fs.Func("method-priority", "comma separated method names to list first for each receiver", func(s string) error {
+		config.MethodPriority = []string{}
+		for _, name := range strings.Split(s, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				config.MethodPriority = append(config.MethodPriority, name)
+			}
+		}
+		return nil
+	})
+	fs.StringVar(&patch, "patch", "", "only reorder declarations touched by this unified diff (- for stdin)")
+	fs.BoolVar(&align, "align-variants", false, "sort two variants of a file, e.g. foo.go and foo_windows.go, into the same order")
+	fs.StringVar(&routes, "order-from-routes", "", "file listing handler names in the order of their routes")
+	fs.StringVar(&renames, "rename-map", "", "file mapping old declaration names to new ones, one \"old new\" pair per line, for -order-lock and -apply-script")
+	fs.StringVar(&tax, "taxonomy", "", "YAML file with categories to group declarations by")
+	fs.StringVar(&report, "html", "", "write a side by side HTML report of the changes to this file instead of sorting")
+	fs.BoolVar(&tests, "verify-tests", false, "with -w, run go test on the package and restore the file if it fails")
+	fs.BoolVar(&suggest, "github-suggestions", false, "print GitHub review suggestions for the out of order regions instead of sorting")
+	fs.BoolVar(&pairs, "report-pairings", false, "print which tests of the _test.go file belong to which declarations as JSON instead of sorting")
+	fs.BoolVar(&cyclo, "complexity", false, "also print the cyclomatic complexity of each function to stderr")
+	fs.BoolVar(&shadows, "lint-shadows", false, "also warn on stderr about declarations named like an imported package")
+	fs.BoolVar(&placed, "comment-report", false, "also print how each comment is moved or pinned to stderr")
+	fs.BoolVar(&audit, "audit-todos", false, "list TODO and FIXME comments with their declaration instead of sorting")
+	fs.StringVar(&lock, "order-lock", "", "keep the declaration order recorded in this lock file, adding new declarations to it")
+	fs.BoolVar(&schema, "config-schema", false, "print a JSON Schema of the JSON encoded order.Config and exit")
+	fs.BoolVar(&emit, "emit-script", false, "print the moves that sort the file as an editable script instead of sorting")
+	fs.StringVar(&planOut, "plan-out", "", "write the moves sorting the file or directory given as the argument to this JSON file instead of sorting")
+	fs.StringVar(&planIn, "apply-plan", "", "perform the moves of this JSON file written by -plan-out, in place")
+	fs.StringVar(&apply, "apply-script", "", "perform exactly the moves of this script instead of sorting")
+	fs.StringVar(&outDir, "output-dir", "", "write sorted copies of the file or directory tree below this directory instead")
+	if err := fs.Parse(args); err != nil {
+		// the flag set has printed the error along with the usage
+		return errUsage
 	}
 
-	for _, c := range tree.Comments {
-		start, end := c.Pos(), c.End()
+	if help {
+		fmt.Fprintln(stdout, "Format:")
+		fmt.Fprintln(stdout, "  go-order [flags] filename...")
+		fmt.Fprintln(stdout, "                   ^ optional, will use stdin if not provided")
+		fs.Usage()
+		return nil
+	}
 
-		// skip doc comments
-		if start < tree.Package {
-			continue
+	if schema {
+		return order.ConfigSchema(stdout)
+	}
+
+	if kinds != "" {
+		var err error
+		config.Order, err = order.ParseOrder(kinds)
+		if err != nil {
+			return err
 		}
+	}
 
-		// skip comments within declarations
-		isRootComment := true
-		for _, d := range tree.Decls {
-			if d.Pos() <= start && end <= d.End() {
-				isRootComment = false
-				break
-			}
+	if tax != "" {
+		f, err := os.Open(tax)
+		if err != nil {
+			return fmt.Errorf("failed to open taxonomy: %w", err)
 		}
+		config.Taxonomy, err = order.ParseTaxonomy(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
 
-		if !isRootComment {
-			continue
+	if renames != "" {
+		f, err := os.Open(renames)
+		if err != nil {
+			return fmt.Errorf("failed to open renames: %w", err)
+		}
+		config.Renames, err = order.ParseRenames(f)
+		f.Close()
+		if err != nil {
+			return err
 		}
+	}
 
-		var found bool
-		for _, d := range tree.Decls {
-			if d.Pos() > c.End() {
-				comment := content[start-1 : end]
-				for i := int(end); i < len(content); i++ {
-					if content[i] == '\n' {
-						comment = append(comment, '\n')
-					} else {
-						break
-					}
-				}
-				comments[d] = append(comments[d], comment...)
-				found = true
-				break
-			}
+	if routes != "" {
+		f, err := os.Open(routes)
+		if err != nil {
+			return fmt.Errorf("failed to open routes: %w", err)
 		}
+		config.RouteOrder, err = readNames(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
 
-		if !found {
-			comments[nil] = append(comments[nil], content[start-1:]...)
+	if outDir != "" {
+		if fs.NArg() != 1 || config.WriteToFile {
+			return errors.New("-output-dir requires exactly one file or directory and cannot be used with -w")
+		}
+		root := fs.Arg(0)
+		info, err := os.Stat(root)
+		if err != nil {
+			return fmt.Errorf("failed to open file: %w", err)
 		}
+		if !info.IsDir() {
+			return writeMirror(root, filepath.Join(outDir, filepath.Base(root)), config)
+		}
+		return mirrorTree(root, outDir, config)
 	}
 
-	return comments
-}
+	if align {
+		if fs.NArg() != 2 || !config.WriteToFile {
+			return errors.New("-align-variants requires the -w flag and exactly two files")
+		}
+		return writeVariants(fs.Arg(0), fs.Arg(1), config)
+	}
 
-// funcName returns the function name in the form of "<receiver type> <function name>"
-// e.g. funcName("func (f Foo) String() {}") = {recv: "Foo", name: "String"}
-// a function without a receiver
-func funcName(f *ast.FuncDecl) funcOrMethod {
-	name := f.Name.Name
-	if f.Recv == nil || len(f.Recv.List) == 0 {
-		return funcOrMethod{name: name}
-	}
-
-	var recv string
-	recvType := f.Recv.List[0].Type
-	switch recvType := recvType.(type) {
-	case *ast.StarExpr:
-		recv = recvType.X.(*ast.Ident).Name
-	case *ast.Ident:
-		recv = recvType.Name
-	default:
-		panic("invalid receiver type: " + reflect.TypeOf(recvType).String())
+	if planOut != "" {
+		if fs.NArg() != 1 {
+			return errors.New("-plan-out requires exactly one file or directory as the argument")
+		}
+		f, err := os.Create(planOut)
+		if err != nil {
+			return fmt.Errorf("failed to create plan: %w", err)
+		}
+		if err := writePlan(f, fs.Arg(0), config); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
 	}
 
-	return funcOrMethod{recv: recv, name: name}
-}
+	if planIn != "" {
+		f, err := os.Open(planIn)
+		if err != nil {
+			return fmt.Errorf("failed to open plan: %w", err)
+		}
+		defer f.Close()
+		return applyPlan(f, stderr, config)
+	}
 
-func getToken(d ast.Decl) token.Token {
-	switch d := d.(type) {
-	case *ast.FuncDecl:
-		return token.FUNC
-	case *ast.GenDecl:
-		return d.Tok
+	switch format {
+	case "":
+	case "diff":
+		diff = true
+	case "patch":
 	default:
-		fmt.Printf("bad declaration: %v\n", reflect.TypeOf(d))
-		panic("unimpl for")
+		return fmt.Errorf("invalid format %q: must be diff or patch", format)
 	}
-}
-
-func logError(err error) error {
-	// log to stderr
-	fmt.Fprintln(os.Stderr, err)
-	os.Exit(1)
-	return nil
-}
-
-func run() error {
-	var (
-		config Config
-		help   bool
-	)
 
-	flag.BoolVar(&help, "h", false, "help")
-	flag.BoolVar(&config.SortAlphabetically, "a", false, "sort alphabetically")
-	flag.BoolVar(&config.WriteToFile, "w", false, "write sorted output back to the file")
-	flag.Parse()
+	mode := printSorted
+	switch {
+	case list:
+		mode = listUnsorted
+	case diff:
+		mode = printDiff
+	case format == "patch":
+		mode = printPatch
+	case check:
+		mode = checkSorted
+		config.WriteToFile = false
+	}
 
-	if help {
-		fmt.Println("Format:")
-		fmt.Println("  go-order [flags] filename")
-		fmt.Println("                   ^ optional, will use stdin if not provided")
-		flag.Usage()
-		return nil
+	// several files are sorted one after the other, printing them all to
+	// stdout would make a single file of them
+	if recurse || fs.NArg() > 1 {
+		var single string
+		fs.Visit(func(f *flag.Flag) {
+			for _, name := range singleFileFlags {
+				if f.Name == name && single == "" {
+					single = name
+				}
+			}
+		})
+		if single != "" {
+			fmt.Fprintf(stderr, "-%s only works on a single file, not with several files or -r\n", single)
+			return errUsage
+		}
+	}
+	if (recurse || fs.NArg() > 1) && mode == printSorted && !config.WriteToFile {
+		return errors.New("sorting several files requires -w, -l, -d or -check")
 	}
 
-	fname := flag.Arg(0)
-	if len(flag.Args()) > 1 {
-		return errors.New("too many arguments: only 0 or 1 supported")
+	if recurse {
+		if fs.NArg() != 1 {
+			return errors.New("-r requires exactly one directory as the argument")
+		}
+		return sortTree(fs.Arg(0), stdout, stderr, config, tests, mode, jobs)
 	}
+	if fs.NArg() > 1 {
+		return sortFiles(fs.Args(), stdout, stderr, config, tests, mode, jobs)
+	}
+
+	fname := fs.Arg(0)
 
 	if config.WriteToFile && fname == "" {
 		return errors.New("-w flag requires you to privide the file name as the argument")
 	}
 
+	if patch == "-" && fname == "" {
+		return errors.New("-patch - reads the diff from stdin and requires you to provide the file name as the argument")
+	}
+
+	if patch != "" {
+		var r io.Reader = stdin
+		if patch != "-" {
+			f, err := os.Open(patch)
+			if err != nil {
+				return fmt.Errorf("failed to open patch: %w", err)
+			}
+			defer f.Close()
+			r = f
+		}
+
+		var err error
+		config.OnlyLines, err = order.ParsePatch(r, fname)
+		if err != nil {
+			return err
+		}
+	}
+
 	// read from file if provided, otherwise use stdin
 	var contents []byte
 	if fname != "" {
@@ -170,26 +395,152 @@ func run() error {
 		f.Close()
 	} else {
 		var err error
-		contents, err = io.ReadAll(os.Stdin)
+		contents, err = io.ReadAll(stdin)
 		if err != nil {
 			return fmt.Errorf("failed to read from stdin: %w", err)
 		}
 	}
 
-	var f *os.File
+	// reported alongside whatever else is done with the file
+	if cyclo {
+		result, err := order.Complexity(contents, config)
+		if err != nil {
+			return err
+		}
+		order.WriteComplexity(stderr, fname, result)
+	}
+	if shadows {
+		found, err := order.Shadows(contents)
+		if err != nil {
+			return err
+		}
+		order.WriteShadows(stderr, fname, found)
+	}
+	if placed {
+		placements, err := order.CommentPlacements(contents, config)
+		if err != nil {
+			return err
+		}
+		order.WriteCommentPlacements(stderr, fname, placements)
+	}
+
+	if report != "" {
+		f, err := os.Create(report)
+		if err != nil {
+			return fmt.Errorf("failed to create report: %w", err)
+		}
+		if err := order.HTMLReport(f, fname, contents, config); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	if emit {
+		moves, err := order.Script(contents, config)
+		if err != nil {
+			return err
+		}
+		return order.WriteScript(stdout, moves)
+	}
+
+	if apply != "" {
+		f, err := os.Open(apply)
+		if err != nil {
+			return fmt.Errorf("failed to open script: %w", err)
+		}
+		moves, err := order.ParseScript(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		var buf bytes.Buffer
+		if err := order.ApplyScript(&buf, contents, moves, config); err != nil {
+			return err
+		}
+		if config.WriteToFile {
+			return replaceFile(fname, contents, buf.Bytes())
+		}
+		_, err = stdout.Write(buf.Bytes())
+		return err
+	}
+
+	if suggest {
+		found, err := order.Suggestions(contents, config)
+		if err != nil {
+			return err
+		}
+		order.WriteSuggestions(stdout, fname, found)
+		return nil
+	}
+
+	if pairs {
+		if fname == "" {
+			return errors.New("-report-pairings requires you to provide the file name as the argument")
+		}
+		tests, err := os.ReadFile(strings.TrimSuffix(fname, ".go") + "_test.go")
+		if err != nil {
+			return fmt.Errorf("failed to read tests: %w", err)
+		}
+		pairings, err := order.PairTests(contents, tests)
+		if err != nil {
+			return err
+		}
+		return order.WritePairings(stdout, pairings)
+	}
+
+	if audit {
+		todos, err := order.AuditTodos(contents, config)
+		if err != nil {
+			return err
+		}
+		order.WriteAudit(stdout, fname, todos)
+		return nil
+	}
+
+	if lock != "" {
+		if fname == "" {
+			return errors.New("-order-lock requires you to provide the file name as the argument")
+		}
+		return sortLocked(stdout, lock, fname, contents, config)
+	}
+
+	if mode != printSorted {
+		err := sortContents(fname, contents, stdout, config, tests, mode)
+		if mode == checkSorted && errors.Is(err, errUnsorted) {
+			if fname == "" {
+				fname = "<stdin>"
+			}
+			fmt.Fprintln(stderr, fname)
+		}
+		return err
+	}
+
 	// write to file if -w, else to stdout
-	var w io.Writer = os.Stdout
 	if config.WriteToFile {
-		var err error
-		f, err = os.OpenFile(fname, os.O_RDWR|os.O_TRUNC, os.ModePerm)
-		if err != nil {
-			return fmt.Errorf("failed to open file for writing: %w", err)
+		if tests {
+			return writeFileTested(fname, contents, config)
 		}
-		w = f
+		return writeFile(fname, contents, config)
 	}
-	bw := bufio.NewWriter(w)
 
-	err := sortFile(contents, bw, config)
+	if config.AssertAPIStable {
+		var buf bytes.Buffer
+		if err := order.OrderTo(&buf, contents, config); err != nil {
+			return fmt.Errorf("sortFile failed: %w", err)
+		}
+		if err := order.AssertAPIStable(contents, buf.Bytes()); err != nil {
+			return err
+		}
+		if _, err := stdout.Write(buf.Bytes()); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		return nil
+	}
+
+	bw := bufio.NewWriter(stdout)
+	err := order.OrderTo(bw, contents, config)
 	if err != nil {
 		return fmt.Errorf("sortFile failed: %w", err)
 	}
@@ -201,132 +552,116 @@ func run() error {
 	return nil
 }
 
-func sortAST(t *ast.File, conf Config) error {
-	sort.Slice(t.Decls, func(i, j int) bool {
-		a, b := t.Decls[i], t.Decls[j]
-		// sort types first
-		aType, bType := getToken(a), getToken(b)
-		if aType != bType {
-			return order[aType] < order[bType]
-		}
-
-		if conf.SortAlphabetically {
-			// two consecutive functions are sorted alphabetically by their name
-			if a, ok := a.(*ast.FuncDecl); ok {
-				if b, ok := b.(*ast.FuncDecl); ok {
-					a, b := funcName(a), funcName(b)
-					// main function goes last
-					if a.recv == "" && a.name == "main" {
-						return false
-					} else if b.recv == "" && b.name == "main" {
-						return true
-					}
-
-					// functions go after methods
-					if a.recv == "" && b.recv != "" {
-						return false
-					}
-					if b.recv == "" && a.recv != "" {
-						return true
-					}
-
-					// sort methods based on the receiver
-					if a.recv != b.recv {
-						return strings.Compare(a.recv, b.recv) < 0
-					}
-
-					// sort functions and methods alphabetically
-					return strings.Compare(a.name, b.name) < 0
-				}
-			}
-			// two consecutive general declarations
-			if a, ok := a.(*ast.GenDecl); ok {
-				if b, ok := b.(*ast.GenDecl); ok {
-					// two individual declarations!
-					if len(a.Specs) == 1 && len(b.Specs) == 1 {
-						var getName func(s ast.Spec) string
-						// type decl
-						if a.Tok == token.TYPE && b.Tok == token.TYPE {
-							getName = func(s ast.Spec) string {
-								return s.(*ast.TypeSpec).Name.Name
-							}
-						} else if a.Tok == token.VAR && b.Tok == token.VAR || a.Tok == token.CONST && b.Tok == token.CONST {
-							getName = func(s ast.Spec) string {
-								return s.(*ast.ValueSpec).Names[0].Name
-							}
-						}
-
-						if getName != nil {
-							a, b := getName(a.Specs[0]), getName(b.Specs[0])
-							return strings.Compare(a, b) < 0
-						}
-					}
-				}
-			}
+// writeFile sorts contents and writes the result back to fname. The file is
+// not touched at all if it is already sorted.
+func writeFile(fname string, contents []byte, config order.Config) error {
+	var buf bytes.Buffer
+	if err := order.OrderTo(&buf, contents, config); err != nil {
+		return fmt.Errorf("sortFile failed: %w", err)
+	}
+
+	if config.Verify {
+		if err := order.VerifyDecls(contents, buf.Bytes(), config); err != nil {
+			return fmt.Errorf("not writing %s: %w", fname, err)
+		}
+	}
+	if config.AssertAPIStable {
+		if err := order.AssertAPIStable(contents, buf.Bytes()); err != nil {
+			return fmt.Errorf("not writing %s: %w", fname, err)
 		}
+	}
 
-		// keep in the same order
-		return false
-	})
-	return nil
+	return replaceFile(fname, contents, buf.Bytes())
 }
 
-// last comments
-func sortFile(contents []byte, w io.Writer, config Config) (error) {
-	ast, err := parser.ParseFile(
-		token.NewFileSet(),
-		"", contents,
-		parser.ParseComments|parser.AllErrors,
-	)
-
+// writeVariants aligns two variants of a file and writes both back
+func writeVariants(fnameA, fnameB string, config order.Config) error {
+	a, err := os.ReadFile(fnameA)
 	if err != nil {
-		return fmt.Errorf("failed paring file to AST: %w", err)
+		return fmt.Errorf("failed to read from file: %w", err)
 	}
-
-	comments := assignRootCommentsToDecl(ast, contents)
-
-	err = sortAST(ast, config)
+	b, err := os.ReadFile(fnameB)
 	if err != nil {
-		return fmt.Errorf("failed to sort AST: %w", err)
+		return fmt.Errorf("failed to read from file: %w", err)
 	}
 
-	write(w, ast, contents, comments)
+	sortedA, sortedB, err := order.AlignVariants(a, b, config)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	if err := replaceFile(fnameA, a, sortedA); err != nil {
+		return err
+	}
+	return replaceFile(fnameB, b, sortedB)
 }
 
-// skip doc comments
-func write(w io.Writer, tree *ast.File, contents []byte, comments map[ast.Decl][]byte) {
-	if tree.Doc != nil {
-		for _, each := range tree.Doc.List {
-			w.Write([]byte(each.Text + "\n"))
-		}
+// replaceFile writes sorted to fname, unless it is identical to the
+// original contents. If fname is a symlink the file it points to is
+// rewritten and the link is left as it is.
+//
+// The output goes to a temporary file next to the target first, which is
+// renamed over the target once it is complete, so that a failed or
+// interrupted write never leaves a truncated file behind.
+func replaceFile(fname string, contents, sorted []byte) error {
+	if bytes.Equal(sorted, contents) {
+		return nil
 	}
 
-	fmt.Fprintf(w, "package %s\n\n", tree.Name)
-
-	for i, decl := range tree.Decls {
-		// trailing comments
-		if comments, ok := comments[decl]; ok {
-			w.Write(comments)
-		}
+	target, err := filepath.EvalSymlinks(fname)
+	if err != nil {
+		return fmt.Errorf("failed to resolve file: %w", err)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
 
-		// declaration itself
-		w.Write(contents[decl.Pos()-1 : decl.End()-1])
+	f, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmp := f.Name()
 
-		// leading new lines
-		if i < len(tree.Decls)-1 {
-			w.Write([]byte("\n\n"))
-		}
+	if _, err := f.Write(sorted); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	// the temporary file is created with 0600, keep the mode of the target
+	if err := os.Chmod(tmp, info.Mode()); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write output: %w", err)
 	}
 
-	if comments, ok := comments[nil]; ok {
-		w.Write(comments)
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace file: %w", err)
 	}
+	return nil
 }
 
+// errUnsorted exits with 1 without printing anything, for -l with stdin and
+// -check
+var errUnsorted = errors.New("input is not sorted")
+
+// errUsage exits with 2 without printing anything, for invalid flags which
+// have already been reported on stderr
+var errUsage = errors.New("invalid flags")
+
 func main() {
-	if err := run(); err != nil {
-		logError(err)
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if errors.Is(err, errUsage) {
+			os.Exit(2)
+		}
+		if errors.Is(err, errUnsorted) {
+			os.Exit(1)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
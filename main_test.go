@@ -2,44 +2,537 @@ package main
 
 import (
 	"bytes"
-	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"os/exec"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/td0m/go-order/order"
 )
 
-//go:embed testdata
-var testdata embed.FS
+func TestWriteFileUnchanged(t *testing.T) {
+	in := `package main
 
-func TestSortAST(t *testing.T) {
-	dirs, err := testdata.ReadDir("testdata")
+import "fmt"
+
+type Foo struct {
+	A int
+}
+
+func (f Foo) String() string {
+	return fmt.Sprint(f.A)
+}
+
+func main() {
+}
+`
+	fname := path.Join(t.TempDir(), "main.go")
+	require.NoError(t, os.WriteFile(fname, []byte(in), 0o644))
+
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(fname, past, past))
+
+	err := writeFile(fname, []byte(in), order.Config{SortAlphabetically: true, Gofmt: true})
+	require.NoError(t, err)
+
+	info, err := os.Stat(fname)
+	require.NoError(t, err)
+	require.True(t, info.ModTime().Equal(past), "file should not have been rewritten")
+}
+
+func TestReplaceFile(t *testing.T) {
+	dir := t.TempDir()
+	fname := path.Join(dir, "a.go")
+	require.NoError(t, os.WriteFile(fname, []byte("package a\n"), 0o644))
+
+	require.NoError(t, replaceFile(fname, []byte("package a\n"), []byte("package b\n")))
+	b, err := os.ReadFile(fname)
+	require.NoError(t, err)
+	require.Equal(t, "package b\n", string(b))
+
+	// the temporary file has been renamed over the original
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// a file that cannot be replaced is left as it was
+	err = replaceFile(path.Join(dir, "missing.go"), nil, []byte("package c\n"))
+	require.Error(t, err)
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestWriteFileMode(t *testing.T) {
+	in := "package a\n\nfunc b() {}\n\nfunc a() {}\n"
+	for _, mode := range []fs.FileMode{0o644, 0o755, 0o600} {
+		fname := path.Join(t.TempDir(), "a.go")
+		require.NoError(t, os.WriteFile(fname, []byte(in), mode))
+		require.NoError(t, os.Chmod(fname, mode)) // regardless of the umask
+
+		require.NoError(t, writeFile(fname, []byte(in), order.Config{SortAlphabetically: true}))
+
+		info, err := os.Stat(fname)
+		require.NoError(t, err)
+		require.Equal(t, mode, info.Mode(), mode.String())
+	}
+}
+
+func TestWriteFileSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := path.Join(dir, "real", "a.go")
+	require.NoError(t, os.MkdirAll(path.Dir(target), 0o755))
+	in := "package a\n\nfunc b() {}\n\nfunc a() {}\n"
+	require.NoError(t, os.WriteFile(target, []byte(in), 0o644))
+
+	link := path.Join(dir, "a.go")
+	require.NoError(t, os.Symlink(path.Join("real", "a.go"), link))
+
+	require.NoError(t, writeFile(link, []byte(in), order.Config{SortAlphabetically: true}))
+
+	// the link still points to the sorted file
+	info, err := os.Lstat(link)
+	require.NoError(t, err)
+	require.True(t, info.Mode()&fs.ModeSymlink != 0, "link should have been preserved")
+	dest, err := os.Readlink(link)
+	require.NoError(t, err)
+	require.Equal(t, path.Join("real", "a.go"), dest)
+
+	b, err := os.ReadFile(target)
+	require.NoError(t, err)
+	require.Equal(t, "package a\n\nfunc a() {}\n\nfunc b() {}\n", string(b))
+}
+
+func TestMirrorTree(t *testing.T) {
+	root, out := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		"main.go":          "package main\n\nfunc b() {}\n\nfunc a() {}\n",
+		"pkg/util.go":      "package pkg\n\nfunc Z() {}\n\nconst A = 1\n",
+		"pkg/README.md":    "not go\n",
+		"testdata/skip.go": "package skip\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(path.Join(root, path.Dir(name)), 0o755))
+		require.NoError(t, os.WriteFile(path.Join(root, name), []byte(content), 0o644))
+	}
+	require.NoError(t, os.Chmod(path.Join(root, "pkg/util.go"), 0o600))
+
+	require.NoError(t, mirrorTree(root, out, order.Config{SortAlphabetically: true}))
+
+	read := func(name string) string {
+		b, err := os.ReadFile(path.Join(out, name))
+		require.NoError(t, err)
+		return string(b)
+	}
+	require.Equal(t, "package main\n\nfunc a() {}\n\nfunc b() {}\n", read("main.go"))
+	require.Equal(t, "package pkg\n\nconst A = 1\n\nfunc Z() {}\n", read("pkg/util.go"))
+
+	info, err := os.Stat(path.Join(out, "pkg/util.go"))
 	require.NoError(t, err)
+	require.Equal(t, fs.FileMode(0o600), info.Mode().Perm())
 
-	paths := make([]string, len(dirs))
-	for i, entry := range dirs {
-		require.True(t, entry.IsDir())
-		paths[i] = path.Join("testdata", entry.Name())
+	for _, name := range []string{"pkg/README.md", "testdata/skip.go"} {
+		_, err := os.Stat(path.Join(out, name))
+		require.True(t, errors.Is(err, fs.ErrNotExist), name)
 	}
 
-	config := Config{
-		SortAlphabetically: true,
+	// the originals are left alone
+	b, err := os.ReadFile(path.Join(root, "main.go"))
+	require.NoError(t, err)
+	require.Equal(t, files["main.go"], string(b))
+
+	// an output directory inside the root is not mirrored into itself
+	inside := path.Join(root, "sorted")
+	require.NoError(t, mirrorTree(root, inside, order.Config{SortAlphabetically: true}))
+	require.NoError(t, mirrorTree(root, inside, order.Config{SortAlphabetically: true}))
+	_, err = os.Stat(path.Join(inside, "main.go"))
+	require.NoError(t, err)
+	_, err = os.Stat(path.Join(inside, "sorted"))
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+
+	require.EqualError(t, mirrorTree(root, root, order.Config{}), "-output-dir must differ from the directory being sorted")
+}
+
+func TestSortTree(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"a.go":          "package a\n\nfunc b() {}\n\nfunc a() {}\n",
+		"broken.go":     "package a\n\nfunc {\n",
+		"sub/c.go":      "package sub\n\nfunc d() {}\n\nconst c = 1\n",
+		"testdata/t.go": "package t\n\nfunc b() {}\n\nfunc a() {}\n",
+		"vendor/x/x.go": "package x\n\nfunc b() {}\n\nfunc a() {}\n",
+		"sub/notes.txt": "func b() {}\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(path.Join(root, path.Dir(name)), 0o755))
+		require.NoError(t, os.WriteFile(path.Join(root, name), []byte(content), 0o644))
 	}
 
-	for _, p := range paths {
-		t.Run(p, func(t *testing.T) {
-			in, err := os.ReadFile(path.Join(p, "in.txt"))
-			require.NoError(t, err)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	// -l lists the unsorted files without touching them
+	err := sortTree(root, stdout, stderr, order.Config{SortAlphabetically: true}, false, listUnsorted, 4)
+	require.EqualError(t, err, "failed to sort 1 files")
+	require.Equal(t, path.Join(root, "a.go")+"\n"+path.Join(root, "sub/c.go")+"\n", stdout.String())
 
-			expected, err := os.ReadFile(path.Join(p, "expected.txt"))
-			require.NoError(t, err)
+	// -check reports them on stderr and writes nothing
+	stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	err = sortTree(root, stdout, stderr, order.Config{SortAlphabetically: true}, false, checkSorted, 4)
+	require.EqualError(t, err, "failed to sort 1 files")
+	require.Empty(t, stdout.String())
+	require.Contains(t, stderr.String(), path.Join(root, "a.go")+"\n"+path.Join(root, "broken.go")+": sortFile failed")
+	require.Contains(t, stderr.String(), path.Join(root, "sub/c.go")+"\n")
 
-			actual := &bytes.Buffer{}
-			err = sortFile(in, actual, config)
-			require.NoError(t, err)
+	stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	err = sortTree(root, stdout, stderr, order.Config{SortAlphabetically: true, WriteToFile: true}, false, printSorted, 4)
+	require.EqualError(t, err, "failed to sort 1 files")
+	require.Contains(t, stderr.String(), "broken.go: sortFile failed")
+	require.Empty(t, stdout.String())
 
-			require.Equal(t, string(expected), actual.String())
-		})
+	read := func(name string) string {
+		b, err := os.ReadFile(path.Join(root, name))
+		require.NoError(t, err)
+		return string(b)
 	}
+	require.Equal(t, "package a\n\nfunc a() {}\n\nfunc b() {}\n", read("a.go"))
+	require.Equal(t, "package sub\n\nconst c = 1\n\nfunc d() {}\n", read("sub/c.go"))
+	for _, name := range []string{"broken.go", "testdata/t.go", "vendor/x/x.go", "sub/notes.txt"} {
+		require.Equal(t, files[name], read(name), name)
+	}
+
+	// a sorted tree passes the check
+	require.NoError(t, os.Remove(path.Join(root, "broken.go")))
+	stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	require.NoError(t, sortTree(root, stdout, stderr, order.Config{SortAlphabetically: true}, false, checkSorted, 4))
+	require.Empty(t, stderr.String())
+
+	require.NoError(t, os.WriteFile(path.Join(root, "a.go"), []byte(files["a.go"]), 0o644))
+	err = sortTree(root, stdout, stderr, order.Config{SortAlphabetically: true}, false, checkSorted, 4)
+	require.ErrorIs(t, err, errUnsorted)
+	require.Equal(t, path.Join(root, "a.go")+"\n", stderr.String())
+}
+
+func TestSortFilesConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	var fnames []string
+	for i := 0; i < 50; i++ {
+		fname := path.Join(dir, fmt.Sprintf("f%02d.go", i))
+		require.NoError(t, os.WriteFile(fname, []byte("package a\n\nfunc b() {}\n\nfunc a() {}\n"), 0o644))
+		fnames = append(fnames, fname)
+	}
+	config := order.Config{SortAlphabetically: true}
+
+	// the output keeps the order of the files
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	require.NoError(t, sortFiles(fnames, stdout, stderr, config, false, listUnsorted, 8))
+	require.Equal(t, strings.Join(fnames, "\n")+"\n", stdout.String())
+
+	config.WriteToFile = true
+	require.NoError(t, sortFiles(fnames, stdout, stderr, config, false, printSorted, 8))
+	for _, fname := range fnames {
+		b, err := os.ReadFile(fname)
+		require.NoError(t, err)
+		require.Equal(t, "package a\n\nfunc a() {}\n\nfunc b() {}\n", string(b), fname)
+	}
+	require.Empty(t, stderr.String())
+}
+
+func TestRun(t *testing.T) {
+	unsorted := "package a\n\nfunc b() {}\n\nfunc a() {}\n"
+	sorted := "package a\n\nfunc a() {}\n\nfunc b() {}\n"
+
+	cmd := func(stdin string, args ...string) (string, string, error) {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		err := run(args, strings.NewReader(stdin), stdout, stderr)
+		return stdout.String(), stderr.String(), err
+	}
+
+	// without a file name the input is read from stdin
+	stdout, _, err := cmd(unsorted, "-a")
+	require.NoError(t, err)
+	require.Equal(t, sorted, stdout)
+
+	fname := path.Join(t.TempDir(), "a.go")
+	require.NoError(t, os.WriteFile(fname, []byte(unsorted), 0o644))
+
+	stdout, _, err = cmd("", "-a", fname)
+	require.NoError(t, err)
+	require.Equal(t, sorted, stdout)
+
+	_, stderr, err := cmd("", "-a", "-check", fname)
+	require.ErrorIs(t, err, errUnsorted)
+	require.Equal(t, fname+"\n", stderr)
+
+	stdout, _, err = cmd("", "-a", "-w", fname)
+	require.NoError(t, err)
+	require.Empty(t, stdout)
+	b, err := os.ReadFile(fname)
+	require.NoError(t, err)
+	require.Equal(t, sorted, string(b))
+
+	_, _, err = cmd("", "-w")
+	require.EqualError(t, err, "-w flag requires you to privide the file name as the argument")
+
+	// several files are sorted independently of each other
+	dir := t.TempDir()
+	names := []string{path.Join(dir, "a.go"), path.Join(dir, "broken.go"), path.Join(dir, "c.go")}
+	require.NoError(t, os.WriteFile(names[0], []byte(unsorted), 0o644))
+	require.NoError(t, os.WriteFile(names[1], []byte("package a\n\nfunc {\n"), 0o644))
+	require.NoError(t, os.WriteFile(names[2], []byte(unsorted), 0o644))
+
+	_, _, err = cmd("", append([]string{"-a"}, names...)...)
+	require.EqualError(t, err, "sorting several files requires -w, -l, -d or -check")
+	_, _, err = cmd("", "-a", "-r", dir)
+	require.EqualError(t, err, "sorting several files requires -w, -l, -d or -check")
+
+	stdout, _, err = cmd("", append([]string{"-a", "-l"}, names[0], names[2])...)
+	require.NoError(t, err)
+	require.Equal(t, names[0]+"\n"+names[2]+"\n", stdout)
+
+	_, stderr, err = cmd("", append([]string{"-a", "-w"}, names...)...)
+	require.EqualError(t, err, "failed to sort 1 files")
+	require.Contains(t, stderr, names[1]+": sortFile failed")
+	for _, name := range []string{names[0], names[2]} {
+		b, err := os.ReadFile(name)
+		require.NoError(t, err)
+		require.Equal(t, sorted, string(b))
+	}
+
+	// flags handled for a single file only are rejected instead of ignored
+	_, stderr, err = cmd("", append([]string{"-a", "-w", "-audit-todos"}, names[0], names[2])...)
+	require.ErrorIs(t, err, errUsage)
+	require.Contains(t, stderr, "-audit-todos only works on a single file")
+	_, stderr, err = cmd("", "-a", "-w", "-html", path.Join(dir, "r.html"), "-r", dir)
+	require.ErrorIs(t, err, errUsage)
+	require.Contains(t, stderr, "-html only works on a single file")
+	require.NoFileExists(t, path.Join(dir, "r.html"))
+
+	_, stderr, err = cmd("", "-no-such-flag")
+	require.ErrorIs(t, err, errUsage)
+	require.Contains(t, stderr, "flag provided but not defined: -no-such-flag")
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	in := "package main\n\nimport \"fmt\"\n\nfunc b() {}\n\nfunc a() {\n\tfmt.Println()\n}\n\nconst c = 1\n"
+
+	out := &bytes.Buffer{}
+	require.NoError(t, sortContents("main.go", []byte(in), out, order.Config{SortAlphabetically: true}, false, printDiff))
+	require.Equal(t, `--- main.go
++++ main.go
+@@ -2,10 +2,10 @@
+ 
+ import "fmt"
+ 
+-func b() {}
++const c = 1
+ 
+ func a() {
+ 	fmt.Println()
+ }
+ 
+-const c = 1
++func b() {}
+`, out.String())
+
+	// the diff applies with patch
+	if _, err := exec.LookPath("patch"); err == nil {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(path.Join(dir, "main.go"), []byte(in), 0o644))
+		cmd := exec.Command("patch", "-p0")
+		cmd.Dir, cmd.Stdin = dir, bytes.NewReader(out.Bytes())
+		require.NoError(t, cmd.Run())
+		b, err := os.ReadFile(path.Join(dir, "main.go"))
+		require.NoError(t, err)
+		sorted, err := order.Order([]byte(in), order.Config{SortAlphabetically: true})
+		require.NoError(t, err)
+		require.Equal(t, string(sorted), string(b))
+	}
+
+	// sorted files print nothing
+	out.Reset()
+	require.NoError(t, sortContents("main.go", []byte("package main\n\nfunc a() {}\n"), out, order.Config{}, false, printDiff))
+	require.Empty(t, out.String())
+
+	require.Equal(t, "--- x\n+++ x\n@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+b\n\\ No newline at end of file\n", string(unifiedDiff("x", "x", []byte("a"), []byte("b"))))
+}
+
+func TestGitPatch(t *testing.T) {
+	in := "package main\n\nfunc b() {}\n\nfunc a() {}\n"
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(dir, "main.go"), []byte(in), 0o644))
+
+	out := &bytes.Buffer{}
+	require.NoError(t, sortContents("./main.go", []byte(in), out, order.Config{SortAlphabetically: true}, false, printPatch))
+	patch := out.String()
+	// the index line holds the same hashes as git hash-object
+	require.Equal(t, `diff --git a/main.go b/main.go
+index 163ebb3..11c5547 100644
+--- a/main.go
++++ b/main.go
+@@ -1,5 +1,5 @@
+ package main
+ 
+-func b() {}
+-
+ func a() {}
++
++func b() {}
+`, patch)
+
+	if _, err := exec.LookPath("git"); err == nil {
+		cmd := exec.Command("git", "apply", "-")
+		cmd.Dir, cmd.Stdin = dir, strings.NewReader(patch)
+		b, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(b))
+		b, err = os.ReadFile(path.Join(dir, "main.go"))
+		require.NoError(t, err)
+		require.Equal(t, "package main\n\nfunc a() {}\n\nfunc b() {}\n", string(b))
+	}
+
+	// the mode of executable files is kept
+	script := path.Join(dir, "script.go")
+	require.NoError(t, os.WriteFile(script, []byte(in), 0o755))
+	patch = string(gitPatch(script, []byte(in), []byte("package main\n")))
+	require.Contains(t, patch, "index 163ebb3..06ab7d0 100755\n")
+}
+
+func TestPlan(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"a.go":      "package a\n\nfunc b() {}\n\nfunc a() {}\n",
+		"sub/c.go":  "package sub\n\nfunc d() {}\n\nconst c = 1\n",
+		"sorted.go": "package a\n\nfunc x() {}\n",
+		// generated files are left alone, like -w does
+		"gen.go": "// Code generated by hand. DO NOT EDIT.\n\npackage a\n\nfunc z() {}\n\nfunc y() {}\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(path.Join(root, path.Dir(name)), 0o755))
+		require.NoError(t, os.WriteFile(path.Join(root, name), []byte(content), 0o644))
+	}
+
+	out := &bytes.Buffer{}
+	require.NoError(t, writePlan(out, root, order.Config{SortAlphabetically: true}))
+
+	var p plan
+	require.NoError(t, json.Unmarshal(out.Bytes(), &p))
+	require.Len(t, p.Files, 2)
+	require.Equal(t, path.Join(root, "a.go"), p.Files[0].Path)
+	require.Equal(t, []order.Move{{Key: "func a"}}, p.Files[0].Moves)
+
+	// a file changed in between is skipped, the others are sorted
+	changed := "package sub\n\nfunc e() {}\n\nconst c = 1\n"
+	require.NoError(t, os.WriteFile(path.Join(root, "sub/c.go"), []byte(changed), 0o644))
+
+	stderr := &bytes.Buffer{}
+	err := applyPlan(bytes.NewReader(out.Bytes()), stderr, order.Config{})
+	require.EqualError(t, err, "skipped 1 changed files")
+	require.Equal(t, path.Join(root, "sub/c.go")+": changed since the plan was made, skipping\n", stderr.String())
+
+	read := func(name string) string {
+		b, err := os.ReadFile(path.Join(root, name))
+		require.NoError(t, err)
+		return string(b)
+	}
+	require.Equal(t, "package a\n\nfunc a() {}\n\nfunc b() {}\n", read("a.go"))
+	require.Equal(t, changed, read("sub/c.go"))
+	require.Equal(t, files["sorted.go"], read("sorted.go"))
+	require.Equal(t, files["gen.go"], read("gen.go"))
+}
+
+func TestOrderLock(t *testing.T) {
+	dir := t.TempDir()
+	fname, lockFile := path.Join(dir, "main.go"), path.Join(dir, "order.lock")
+
+	sortWithConfig := func(in string, config order.Config) string {
+		require.NoError(t, os.WriteFile(fname, []byte(in), 0o644))
+		config.WriteToFile = true
+		require.NoError(t, sortLocked(io.Discard, lockFile, fname, []byte(in), config))
+		b, err := os.ReadFile(fname)
+		require.NoError(t, err)
+		return string(b)
+	}
+	sortWith := func(in string) string {
+		return sortWithConfig(in, order.Config{SortAlphabetically: true})
+	}
+
+	// dry runs print the sorted file and leave the lock alone
+	out := &bytes.Buffer{}
+	require.NoError(t, sortLocked(out, lockFile, fname, []byte("package main\n\nfunc b() {}\n\nfunc a() {}\n"), order.Config{SortAlphabetically: true}))
+	require.Equal(t, "package main\n\nfunc a() {}\n\nfunc b() {}\n", out.String())
+	require.NoFileExists(t, lockFile)
+
+	// the first run records the sorted order
+	require.Equal(t, "package main\n\nfunc a() {}\n\nfunc b() {}\n", sortWith("package main\n\nfunc b() {}\n\nfunc a() {}\n"))
+	lock, err := readLock(lockFile)
+	require.NoError(t, err)
+	require.Equal(t, orderLock{"main.go": {"func a", "func b"}}, lock)
+
+	// later runs follow the lock, even if the options would sort otherwise
+	require.NoError(t, writeLock(lockFile, orderLock{"main.go": {"func b", "func a"}}))
+	require.Equal(t, "package main\n\nfunc b() {}\n\nfunc a() {}\n", sortWith("package main\n\nfunc a() {}\n\nfunc b() {}\n"))
+
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(lockFile, past, past))
+	sortWith("package main\n\nfunc a() {}\n\nfunc b() {}\n")
+	info, err := os.Stat(lockFile)
+	require.NoError(t, err)
+	require.True(t, info.ModTime().Equal(past), "lock should not have been rewritten")
+
+	// new declarations are added, removed ones dropped
+	require.Equal(t, "package main\n\nfunc b() {}\n\nfunc c() {}\n", sortWith("package main\n\nfunc c() {}\n\nfunc b() {}\n"))
+	lock, err = readLock(lockFile)
+	require.NoError(t, err)
+	require.Equal(t, orderLock{"main.go": {"func b", "func c"}}, lock)
+
+	// a renamed declaration keeps its place through the rename map
+	config := order.Config{SortAlphabetically: true, Renames: map[string]string{"b": "z"}}
+	require.Equal(t, "package main\n\nfunc z() {}\n\nfunc c() {}\n", sortWithConfig("package main\n\nfunc c() {}\n\nfunc z() {}\n", config))
+	lock, err = readLock(lockFile)
+	require.NoError(t, err)
+	require.Equal(t, orderLock{"main.go": {"func z", "func c"}}, lock)
+
+	// the key does not depend on how the file is named
+	require.Equal(t, "main.go", lockKey(lockFile, path.Join(dir, "sub", "..", "main.go")))
+	require.Equal(t, "sub/a.go", lockKey("order.lock", "./sub/a.go"))
+	require.Equal(t, "a.go", lockKey("sub/order.lock", "sub/../sub/a.go"))
+}
+
+func TestWriteFileTested(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+
+	in := []byte("package main\n\nfunc b() {}\n\nfunc a() {}\n")
+	fname := path.Join(t.TempDir(), "main.go")
+	require.NoError(t, os.WriteFile(fname, in, 0o644))
+
+	defer func(orig func(string) error) { runTests = orig }(runTests)
+
+	var dir string
+	runTests = func(d string) error {
+		dir = d
+		return errors.New("init order changed")
+	}
+
+	err := writeFileTested(fname, in, order.Config{SortAlphabetically: true})
+	require.EqualError(t, err, "restored "+fname+": init order changed")
+	require.Equal(t, path.Dir(fname), dir)
+
+	out, err := os.ReadFile(fname)
+	require.NoError(t, err)
+	require.Equal(t, string(in), string(out))
+
+	runTests = func(string) error { return nil }
+	require.NoError(t, writeFileTested(fname, in, order.Config{SortAlphabetically: true}))
+
+	out, err = os.ReadFile(fname)
+	require.NoError(t, err)
+	require.Equal(t, "package main\n\nfunc a() {}\n\nfunc b() {}\n", string(out))
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/td0m/go-order/order"
+)
+
+// mirrorTree sorts every go file below root and writes the results to the
+// same relative paths below outDir, leaving the originals untouched. An
+// outDir inside root is left out, so that earlier results are not mirrored
+// again.
+func mirrorTree(root, outDir string, config order.Config) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	absOut, err := filepath.Abs(outDir)
+	if err != nil {
+		return err
+	}
+	if absRoot == absOut {
+		return errors.New("-output-dir must differ from the directory being sorted")
+	}
+
+	return walkGoFiles(root, func(p string) error {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(absOut, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		return writeMirror(p, filepath.Join(outDir, rel), config)
+	})
+}
+
+// writeMirror sorts fname and writes the result to target with the same
+// file mode, creating the parent directories as needed
+func writeMirror(fname, target string, config order.Config) error {
+	info, err := os.Stat(fname)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	contents, err := os.ReadFile(fname)
+	if err != nil {
+		return fmt.Errorf("failed to read from file: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := order.OrderTo(&buf, contents, config); err != nil {
+		return fmt.Errorf("sortFile failed for %s: %w", fname, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := os.WriteFile(target, buf.Bytes(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	// the umask applies to new files and existing files keep their mode
+	return os.Chmod(target, info.Mode().Perm())
+}
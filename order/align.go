@@ -0,0 +1,143 @@
+package order
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"sort"
+	"strings"
+)
+
+// AlignVariants sorts two variants of the same file, e.g. foo.go and
+// foo_windows.go, and then reorders them so that the declarations they
+// share appear in the same relative order in both. Declarations found only
+// in b are placed by name among the shared declarations of their kind.
+func AlignVariants(a, b []byte, config Config) ([]byte, []byte, error) {
+	fsetA, treeA, commentsA, err := parseFile(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	fsetB, treeB, commentsB, err := parseFile(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := sortAST(fsetA, treeA, config); err != nil {
+		return nil, nil, fmt.Errorf("failed to sort AST: %w", err)
+	}
+	if err := sortAST(fsetB, treeB, config); err != nil {
+		return nil, nil, fmt.Errorf("failed to sort AST: %w", err)
+	}
+
+	keysA, keysB := declKeys(treeA.Decls), declKeys(treeB.Decls)
+	union := variantOrder(keysA, keysB)
+	reorderByKeys(treeA, keysA, union)
+	reorderByKeys(treeB, keysB, union)
+
+	var outA, outB bytes.Buffer
+	if err := output(&outA, fsetA, treeA, a, commentsA, config); err != nil {
+		return nil, nil, err
+	}
+	if err := output(&outB, fsetB, treeB, b, commentsB, config); err != nil {
+		return nil, nil, err
+	}
+	return outA.Bytes(), outB.Bytes(), nil
+}
+
+// unionOrder merges b into a, placing every key missing from a right after
+// the key that precedes it in b. It returns the position of every key.
+func unionOrder(a, b []string) map[string]int {
+	union := append([]string{}, a...)
+	index := func(key string) int {
+		for i, k := range union {
+			if k == key {
+				return i
+			}
+		}
+		return -1
+	}
+
+	prev := -1
+	for _, key := range b {
+		if i := index(key); i >= 0 {
+			prev = i
+			continue
+		}
+
+		prev++
+		union = append(union[:prev], append([]string{key}, union[prev:]...)...)
+	}
+
+	return keyPositions(union)
+}
+
+// variantOrder merges b into a like unionOrder, except that every key
+// missing from a goes right before the first key of the same kind shared
+// by a and b with a greater name, or after the last one. Keys of a kind
+// that a and b do not share follow the key that precedes them in b.
+func variantOrder(a, b []string) map[string]int {
+	inA := make(map[string]bool, len(a))
+	for _, key := range a {
+		inA[key] = true
+	}
+	inB := make(map[string]bool, len(b))
+	for _, key := range b {
+		inB[key] = true
+	}
+
+	union := append([]string{}, a...)
+	prev := -1
+	for _, key := range b {
+		if inA[key] {
+			for i, k := range union {
+				if k == key {
+					prev = i
+				}
+			}
+			continue
+		}
+
+		kind, name, _ := strings.Cut(key, " ")
+		at := -1
+		for i, k := range union {
+			if !inA[k] || !inB[k] {
+				continue
+			}
+			if kk, kn, _ := strings.Cut(k, " "); kk == kind {
+				if kn > name {
+					at = i
+					break
+				}
+				at = i + 1
+			}
+		}
+		if at < 0 {
+			at = prev + 1
+		}
+
+		union = append(union[:at], append([]string{key}, union[at:]...)...)
+		prev = at
+	}
+
+	return keyPositions(union)
+}
+
+// keyPositions returns the index of every key
+func keyPositions(keys []string) map[string]int {
+	positions := make(map[string]int, len(keys))
+	for i, key := range keys {
+		positions[key] = i
+	}
+	return positions
+}
+
+// reorderByKeys sorts the declarations of t by the position of their key
+func reorderByKeys(t *ast.File, keys []string, positions map[string]int) {
+	pos := make(map[ast.Decl]int, len(t.Decls))
+	for i, d := range t.Decls {
+		pos[d] = positions[keys[i]]
+	}
+	sort.SliceStable(t.Decls, func(i, j int) bool {
+		return pos[t.Decls[i]] < pos[t.Decls[j]]
+	})
+}
@@ -0,0 +1,95 @@
+package order
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+)
+
+// AssertAPIStable checks that every exported identifier of original is
+// declared in sorted with the same signature and that none were added.
+// Moving declarations never changes the API, so any difference is a bug.
+func AssertAPIStable(original, sorted []byte) error {
+	before, err := apiSurface(original)
+	if err != nil {
+		return err
+	}
+	after, err := apiSurface(sorted)
+	if err != nil {
+		return fmt.Errorf("sorted output is invalid: %w", err)
+	}
+
+	for _, key := range before.keys {
+		sig, ok := after.text[key]
+		if !ok {
+			return fmt.Errorf("exported %s is missing from the sorted output", key)
+		}
+		if !bytes.Equal(sig, before.text[key]) {
+			return fmt.Errorf("signature of exported %s changed while sorting", key)
+		}
+	}
+	for _, key := range after.keys {
+		if _, ok := before.text[key]; !ok {
+			return fmt.Errorf("exported %s appeared while sorting", key)
+		}
+	}
+	return nil
+}
+
+// apiSurface returns the signature of every exported identifier of src,
+// keyed like declKey, e.g. "func Foo.String" or "const Max". Signatures
+// leave out comments and function bodies.
+func apiSurface(src []byte) (declTexts, error) {
+	fset, tree, _, err := parseFile(src)
+	if err != nil {
+		return declTexts{}, err
+	}
+
+	api := declTexts{text: map[string][]byte{}}
+	add := func(key string, node ast.Node) {
+		var buf bytes.Buffer
+		printer.Fprint(&buf, fset, node)
+		if _, ok := api.text[key]; !ok {
+			api.keys = append(api.keys, key)
+		}
+		api.text[key] = buf.Bytes()
+	}
+
+	for _, d := range tree.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if !d.Name.IsExported() {
+				continue
+			}
+			sig := *d
+			sig.Doc, sig.Body = nil, nil
+			add("func "+funcName(d).String(), &sig)
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			for _, spec := range d.Specs {
+				switch spec := spec.(type) {
+				case *ast.ValueSpec:
+					sig := *spec
+					sig.Doc, sig.Comment = nil, nil
+					for _, name := range spec.Names {
+						if name.IsExported() {
+							add(d.Tok.String()+" "+name.Name, &sig)
+						}
+					}
+				case *ast.TypeSpec:
+					if !spec.Name.IsExported() {
+						continue
+					}
+					sig := *spec
+					sig.Doc, sig.Comment = nil, nil
+					add("type "+spec.Name.Name, &sig)
+				}
+			}
+		}
+	}
+	return api, nil
+}
@@ -0,0 +1,94 @@
+package order
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Todo is a TODO or FIXME comment along with the declaration it belongs to
+type Todo struct {
+	Line int
+	Text string
+	// Decl is the key of the declaration the comment is part of or
+	// attached to, empty for comments at the end of the file
+	Decl string
+}
+
+// AuditTodos returns the TODO and FIXME comments of the file, in the order
+// of their declarations after sorting
+func AuditTodos(contents []byte, config Config) ([]Todo, error) {
+	fset, tree, _, err := parseFile(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	owner := func(c *ast.Comment) ast.Decl {
+		for _, d := range tree.Decls {
+			// within the declaration or leading up to it
+			if c.End() <= d.End() {
+				return d
+			}
+		}
+		return nil
+	}
+
+	type entry struct {
+		Todo
+		owner ast.Decl
+	}
+
+	var entries []entry
+	for _, group := range tree.Comments {
+		for _, c := range group.List {
+			text := strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(c.Text, "//"), "/*"))
+			text = strings.TrimSpace(strings.TrimSuffix(text, "*/"))
+			if !strings.HasPrefix(text, "TODO") && !strings.HasPrefix(text, "FIXME") {
+				continue
+			}
+			entries = append(entries, entry{
+				Todo:  Todo{Line: fset.Position(c.Pos()).Line, Text: text},
+				owner: owner(c),
+			})
+		}
+	}
+
+	if err := sortAST(fset, tree, config); err != nil {
+		return nil, fmt.Errorf("failed to sort AST: %w", err)
+	}
+
+	// list in the order of the sorted declarations
+	keys := declKeys(tree.Decls)
+	rank := map[ast.Decl]int{nil: len(tree.Decls)}
+	for i, d := range tree.Decls {
+		rank[d] = i
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return rank[entries[i].owner] < rank[entries[j].owner]
+	})
+
+	todos := make([]Todo, len(entries))
+	for i, e := range entries {
+		todos[i] = e.Todo
+		if e.owner != nil {
+			todos[i].Decl = keys[rank[e.owner]]
+		}
+	}
+	return todos, nil
+}
+
+// WriteAudit prints the todos, one per line
+func WriteAudit(w io.Writer, fname string, todos []Todo) {
+	if fname == "" {
+		fname = "<stdin>"
+	}
+	for _, t := range todos {
+		decl := t.Decl
+		if decl == "" {
+			decl = "end of file"
+		}
+		fmt.Fprintf(w, "%s:%d: %s (%s)\n", fname, t.Line, t.Text, decl)
+	}
+}
@@ -0,0 +1,258 @@
+package order
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// barrierDirective marks a line that declarations cannot be moved across
+const barrierDirective = "//order:barrier"
+
+// startDirective marks the line below which declarations are sorted, the
+// ones above it are left exactly as they are
+const startDirective = "//order:start"
+
+// offDirective and onDirective mark a region whose declarations stay in
+// their source order and place while the rest of the file is sorted. They
+// are written as "// go-order:off", with or without the space.
+const (
+	offDirective = "go-order:off"
+	onDirective  = "go-order:on"
+)
+
+// barrier is a //order:barrier comment along with the root comments above
+// it, which stay in place while the declarations below it are sorted
+type barrier struct {
+	// index of the first declaration below the barrier
+	index int
+	text  []byte
+}
+
+// sysDirectives start the lines that mksyscall of golang.org/x/sys turns
+// into functions, in the order they are listed
+var sysDirectives = []string{"//sys ", "//sys\t", "//sysnb ", "//sysnb\t"}
+
+// barrierPositions returns the positions of the //order:barrier,
+// //order:start, // go-order:off and // go-order:on comments outside of
+// declarations and not at the end of their line. Free standing groups of
+// //sys directives act as barriers too, so that they stay in place and in
+// order.
+func barrierPositions(fset *token.FileSet, t *ast.File) []token.Pos {
+	docs := map[*ast.CommentGroup]bool{}
+	for _, d := range t.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			docs[d.Doc] = true
+		case *ast.GenDecl:
+			docs[d.Doc] = true
+		}
+	}
+
+	lines := lineComments(fset, t)
+	var positions []token.Pos
+	for _, c := range t.Comments {
+		if c.Pos() < t.Package || lines[c] != nil {
+			continue
+		}
+		if isSysDirectives(c) && !docs[c] && !withinDecl(t, c.Pos()) {
+			positions = append(positions, c.Pos())
+			continue
+		}
+		for _, line := range c.List {
+			isBarrier := strings.HasPrefix(line.Text, barrierDirective) || strings.HasPrefix(line.Text, startDirective) ||
+				isGoOrderDirective(line.Text, offDirective) || isGoOrderDirective(line.Text, onDirective)
+			if isBarrier && !withinDecl(t, line.Pos()) {
+				positions = append(positions, line.Pos())
+				break
+			}
+		}
+	}
+	return positions
+}
+
+// startPosition returns the position of the first //order:start comment
+// outside of declarations, or token.NoPos if there is none
+func startPosition(fset *token.FileSet, t *ast.File) token.Pos {
+	lines := lineComments(fset, t)
+	for _, c := range t.Comments {
+		if c.Pos() < t.Package || lines[c] != nil {
+			continue
+		}
+		for _, line := range c.List {
+			if strings.HasPrefix(line.Text, startDirective) && !withinDecl(t, line.Pos()) {
+				return line.Pos()
+			}
+		}
+	}
+	return token.NoPos
+}
+
+// startIndex returns the index of the first declaration below the
+// //order:start comment, 0 if there is none
+func startIndex(fset *token.FileSet, t *ast.File) int {
+	pos := startPosition(fset, t)
+	if !pos.IsValid() {
+		return 0
+	}
+	for i, d := range t.Decls {
+		if d.Pos() > pos {
+			return i
+		}
+	}
+	return len(t.Decls)
+}
+
+// offRegions returns the start and end of each // go-order:off region. A
+// region without a // go-order:on comment lasts until the end of the file.
+func offRegions(fset *token.FileSet, t *ast.File) [][2]token.Pos {
+	var (
+		regions [][2]token.Pos
+		off     token.Pos
+		lines   = lineComments(fset, t)
+	)
+	for _, c := range t.Comments {
+		if c.Pos() < t.Package || lines[c] != nil {
+			continue
+		}
+		for _, line := range c.List {
+			if withinDecl(t, line.Pos()) {
+				continue
+			}
+			switch {
+			case isGoOrderDirective(line.Text, offDirective) && !off.IsValid():
+				off = line.Pos()
+			case isGoOrderDirective(line.Text, onDirective) && off.IsValid():
+				regions = append(regions, [2]token.Pos{off, line.Pos()})
+				off = token.NoPos
+			}
+		}
+	}
+	if off.IsValid() {
+		regions = append(regions, [2]token.Pos{off, t.End()})
+	}
+	return regions
+}
+
+// frozen reports whether d is within one of regions
+func frozen(d ast.Decl, regions [][2]token.Pos) bool {
+	for _, r := range regions {
+		if r[0] < d.Pos() && d.Pos() < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// isDirective reports whether the comment text is the directive, optionally
+// followed by an explanation
+func isDirective(text, directive string) bool {
+	return text == directive || strings.HasPrefix(text, directive+" ")
+}
+
+// isGoOrderDirective reports whether the comment text is one of the
+// go-order: directives, with or without a space after the slashes, see
+// offDirective
+func isGoOrderDirective(text, directive string) bool {
+	return isDirective(text, "//"+directive) || isDirective(text, "// "+directive)
+}
+
+// keepTop returns rewritten with everything above its //order:start comment
+// replaced by what is above it in contents, so that rewriting declarations
+// leaves the top of the file alone too
+func keepTop(contents, rewritten []byte) []byte {
+	fset, before, _, err := parseFile(contents)
+	if err != nil {
+		return rewritten
+	}
+	rewrittenFset, after, _, err := parseFile(rewritten)
+	if err != nil {
+		return rewritten
+	}
+	from, to := startPosition(fset, before), startPosition(rewrittenFset, after)
+	if !from.IsValid() || !to.IsValid() {
+		return rewritten
+	}
+	return append(append([]byte{}, contents[:from-1]...), rewritten[to-1:]...)
+}
+
+// isSysDirectives reports whether every line of c is a //sys directive
+func isSysDirectives(c *ast.CommentGroup) bool {
+	for _, line := range c.List {
+		if !hasAnyPrefix(line.Text, sysDirectives) {
+			return false
+		}
+	}
+	return true
+}
+
+func withinDecl(t *ast.File, pos token.Pos) bool {
+	for _, d := range t.Decls {
+		if d.Pos() <= pos && pos < d.End() {
+			return true
+		}
+	}
+	return false
+}
+
+// partition splits decls at the barriers into slices sharing the same
+// backing array, so sorting each of them sorts decls in place
+func partition(decls []ast.Decl, barriers []token.Pos) [][]ast.Decl {
+	var (
+		parts [][]ast.Decl
+		start int
+	)
+	for i := 1; i < len(decls); i++ {
+		for _, pos := range barriers {
+			if decls[i-1].End() <= pos && pos < decls[i].Pos() {
+				parts = append(parts, decls[start:i])
+				start = i
+				break
+			}
+		}
+	}
+	return append(parts, decls[start:])
+}
+
+// detachBarriers takes the barrier comments, and the comments above them,
+// away from the declarations below so they stay in place while sorting
+func detachBarriers(fset *token.FileSet, t *ast.File, contents []byte, comments map[ast.Decl][]byte) []barrier {
+	var barriers []barrier
+	for _, pos := range barrierPositions(fset, t) {
+		for i, d := range t.Decls {
+			if d.Pos() < pos {
+				continue
+			}
+
+			// cut right after the comment group holding the barrier
+			var text []byte
+			for _, c := range t.Comments {
+				if c.Pos() <= pos && pos < c.End() {
+					text = commentWithNewlines(contents, c)
+				}
+			}
+			end := bytes.Index(comments[d], text)
+			if end < 0 {
+				break
+			}
+			end += len(text)
+
+			barriers = append(barriers, barrier{index: i, text: comments[d][:end:end]})
+			comments[d] = comments[d][end:]
+			break
+		}
+	}
+	return barriers
+}
+
+// attachBarriers puts the barrier comments back above whichever declaration
+// is now first below them. Barriers above the same declaration are put back
+// last to first to keep their order.
+func attachBarriers(t *ast.File, comments map[ast.Decl][]byte, barriers []barrier) {
+	for i := len(barriers) - 1; i >= 0; i-- {
+		b := barriers[i]
+		d := t.Decls[b.index]
+		comments[d] = append(append([]byte{}, b.text...), comments[d]...)
+	}
+}
@@ -0,0 +1,195 @@
+package order
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// chunk is the source of one element of a block, such as a spec of a const
+// block or a field of a struct, as whole lines including its comments
+type chunk struct {
+	start, end int
+	// position of the element within its block
+	index int
+}
+
+// edit replaces src[start:end] with text
+type edit struct {
+	start, end int
+	text       []byte
+}
+
+// elementChunk returns the lines spanned by node along with its doc and
+// line comments. ok is false if those lines are shared with anything else.
+func elementChunk(src []byte, index int, doc *ast.CommentGroup, node ast.Node, comment *ast.CommentGroup) (c chunk, ok bool) {
+	start, end := int(node.Pos())-1, int(node.End())-1
+	if doc != nil {
+		start = int(doc.Pos()) - 1
+	}
+	if comment != nil {
+		end = int(comment.End()) - 1
+	}
+
+	lineStart := bytes.LastIndexByte(src[:start], '\n') + 1
+	if len(bytes.TrimSpace(src[lineStart:start])) > 0 {
+		return chunk{}, false
+	}
+
+	lineEnd := len(src)
+	if i := bytes.IndexByte(src[end:], '\n'); i >= 0 {
+		lineEnd = end + i + 1
+	}
+	if len(bytes.TrimSpace(src[end:lineEnd])) > 0 {
+		return chunk{}, false
+	}
+
+	return chunk{start: lineStart, end: lineEnd, index: index}, true
+}
+
+// sortChunks sorts runs of consecutive chunks. Blank lines or free standing
+// comments between chunks separate the runs, so existing groups stay intact.
+func sortChunks(src []byte, chunks []chunk, less func(a, b int) bool) []edit {
+	var (
+		edits []edit
+		group []chunk
+	)
+	flush := func() {
+		if len(group) < 2 {
+			return
+		}
+		sorted := append([]chunk{}, group...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return less(sorted[i].index, sorted[j].index)
+		})
+
+		var text []byte
+		changed := false
+		for i, c := range sorted {
+			text = append(text, src[c.start:c.end]...)
+			// the last line of the file may not end with a new line
+			if text[len(text)-1] != '\n' {
+				text = append(text, '\n')
+			}
+			changed = changed || c.index != group[i].index
+		}
+		if changed {
+			last := group[len(group)-1]
+			if src[last.end-1] != '\n' {
+				text = text[:len(text)-1]
+			}
+			edits = append(edits, edit{start: group[0].start, end: last.end, text: text})
+		}
+	}
+
+	for i, c := range chunks {
+		if i > 0 && c.start != chunks[i-1].end {
+			flush()
+			group = nil
+		}
+		group = append(group, c)
+	}
+	flush()
+
+	return edits
+}
+
+// applyEdits returns a copy of src with the non overlapping edits applied
+func applyEdits(src []byte, edits []edit) []byte {
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+
+	out := append([]byte{}, src...)
+	for _, e := range edits {
+		out = append(out[:e.start], append(append([]byte{}, e.text...), out[e.end:]...)...)
+	}
+	return out
+}
+
+// sortSpecs sorts the specs within parenthesized const, var and type blocks
+// by name. Const blocks relying on iota or implicit repetition are left
+// alone since their values depend on the order.
+func sortSpecs(contents []byte, config Config) ([]byte, error) {
+	_, tree, _, err := parseFile(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	var edits []edit
+	for _, d := range tree.Decls {
+		d, ok := d.(*ast.GenDecl)
+		if !ok || !d.Lparen.IsValid() || d.Tok == token.IMPORT {
+			continue
+		}
+		if d.Tok == token.CONST && dependsOnOrder(d) {
+			continue
+		}
+
+		var (
+			chunks = make([]chunk, 0, len(d.Specs))
+			names  = make([]string, len(d.Specs))
+			docs   = make([]bool, len(d.Specs))
+		)
+		for i, spec := range d.Specs {
+			var (
+				doc, comment *ast.CommentGroup
+			)
+			switch spec := spec.(type) {
+			case *ast.ValueSpec:
+				doc, comment = spec.Doc, spec.Comment
+				names[i] = spec.Names[0].Name
+			case *ast.TypeSpec:
+				doc, comment = spec.Doc, spec.Comment
+				names[i] = spec.Name.Name
+			}
+			docs[i] = doc != nil || comment != nil
+
+			c, ok := elementChunk(contents, i, doc, spec, comment)
+			if !ok {
+				chunks = nil
+				break
+			}
+			chunks = append(chunks, c)
+		}
+
+		edits = append(edits, sortChunks(contents, chunks, func(a, b int) bool {
+			if config.DocumentedSpecsFirst && docs[a] != docs[b] {
+				return docs[a]
+			}
+			return strings.Compare(names[a], names[b]) < 0
+		})...)
+	}
+
+	return applyEdits(contents, edits), nil
+}
+
+// dependsOnOrder reports whether the values of a const block depend on the
+// order of its specs, through iota or specs repeating the previous value
+func dependsOnOrder(d *ast.GenDecl) bool {
+	for _, spec := range d.Specs {
+		spec := spec.(*ast.ValueSpec)
+		if len(spec.Values) == 0 {
+			return true
+		}
+		for _, v := range spec.Values {
+			if usesIota(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func usesIota(expr ast.Expr) bool {
+	found := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && ident.Name == "iota" {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
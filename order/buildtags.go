@@ -0,0 +1,129 @@
+package order
+
+import (
+	"go/ast"
+	"go/build/constraint"
+	"sort"
+	"strings"
+)
+
+// normalizeBuildTags sorts the operands of every && and || chain in the
+// build constraints above the package clause. A legacy // +build line is
+// regenerated from the //go:build line so that the two stay in sync.
+func normalizeBuildTags(contents []byte) ([]byte, error) {
+	_, tree, _, err := parseFile(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		goBuild   constraint.Expr
+		plusBuild []*ast.Comment
+		edits     []edit
+	)
+	for _, group := range tree.Comments {
+		if group.Pos() >= tree.Package {
+			break
+		}
+		for _, c := range group.List {
+			switch {
+			case constraint.IsGoBuild(c.Text):
+				expr, err := constraint.Parse(c.Text)
+				if err != nil {
+					continue
+				}
+				goBuild = normalizeExpr(expr)
+				edits = append(edits, replaceComment(c, "//go:build "+goBuild.String()))
+			case constraint.IsPlusBuild(c.Text):
+				plusBuild = append(plusBuild, c)
+			}
+		}
+	}
+
+	if goBuild != nil && len(plusBuild) > 0 {
+		lines, err := constraint.PlusBuildLines(goBuild)
+		if err != nil {
+			// too complex for +build lines, leave them as they are
+			return applyEdits(contents, edits), nil
+		}
+		edits = append(edits, replaceComment(plusBuild[0], strings.Join(lines, "\n")))
+		for _, c := range plusBuild[1:] {
+			e := replaceComment(c, "")
+			if e.end < len(contents) && contents[e.end] == '\n' {
+				e.end++
+			}
+			edits = append(edits, e)
+		}
+		return applyEdits(contents, edits), nil
+	}
+
+	// without a //go:build line each +build line stands on its own
+	for _, c := range plusBuild {
+		expr, err := constraint.Parse(c.Text)
+		if err != nil {
+			continue
+		}
+		lines, err := constraint.PlusBuildLines(normalizeExpr(expr))
+		if err != nil {
+			continue
+		}
+		edits = append(edits, replaceComment(c, strings.Join(lines, "\n")))
+	}
+	return applyEdits(contents, edits), nil
+}
+
+// normalizeExpr returns expr with the operands of each chain of the same
+// operator sorted. Operands are never moved across operators, so the result
+// is logically equivalent.
+func normalizeExpr(expr constraint.Expr) constraint.Expr {
+	switch e := expr.(type) {
+	case *constraint.NotExpr:
+		return &constraint.NotExpr{X: normalizeExpr(e.X)}
+	case *constraint.AndExpr:
+		operands := sortOperands(flattenAnd(e))
+		result := operands[0]
+		for _, x := range operands[1:] {
+			result = &constraint.AndExpr{X: result, Y: x}
+		}
+		return result
+	case *constraint.OrExpr:
+		operands := sortOperands(flattenOr(e))
+		result := operands[0]
+		for _, x := range operands[1:] {
+			result = &constraint.OrExpr{X: result, Y: x}
+		}
+		return result
+	}
+	return expr
+}
+
+func flattenAnd(expr constraint.Expr) []constraint.Expr {
+	if e, ok := expr.(*constraint.AndExpr); ok {
+		return append(flattenAnd(e.X), flattenAnd(e.Y)...)
+	}
+	return []constraint.Expr{expr}
+}
+
+func flattenOr(expr constraint.Expr) []constraint.Expr {
+	if e, ok := expr.(*constraint.OrExpr); ok {
+		return append(flattenOr(e.X), flattenOr(e.Y)...)
+	}
+	return []constraint.Expr{expr}
+}
+
+// sortOperands normalizes each operand and sorts them by their text
+func sortOperands(operands []constraint.Expr) []constraint.Expr {
+	for i, x := range operands {
+		operands[i] = normalizeExpr(x)
+	}
+	sort.SliceStable(operands, func(i, j int) bool {
+		return operands[i].String() < operands[j].String()
+	})
+	return operands
+}
+
+// replaceComment returns an edit replacing the text of c
+func replaceComment(c *ast.Comment, text string) edit {
+	start := int(c.Pos()) - 1
+	return edit{start: start, end: start + len(c.Text), text: []byte(text)}
+}
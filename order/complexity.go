@@ -0,0 +1,81 @@
+package order
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+)
+
+// DeclComplexity is the cyclomatic complexity of a function or method
+type DeclComplexity struct {
+	// Decl is the key of the declaration, e.g. "func Foo.String"
+	Decl       string
+	Line       int
+	Complexity int
+}
+
+// Complexity returns the cyclomatic complexity of each function and method
+// of the file, in the order of their declarations after sorting
+func Complexity(contents []byte, config Config) ([]DeclComplexity, error) {
+	fset, tree, _, err := parseFile(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sortAST(fset, tree, config); err != nil {
+		return nil, fmt.Errorf("failed to sort AST: %w", err)
+	}
+
+	var result []DeclComplexity
+	keys := declKeys(tree.Decls)
+	for i, d := range tree.Decls {
+		f, ok := d.(*ast.FuncDecl)
+		if !ok || f.Body == nil {
+			continue
+		}
+		result = append(result, DeclComplexity{
+			Decl:       keys[i],
+			Line:       fset.Position(f.Pos()).Line,
+			Complexity: complexity(f.Body),
+		})
+	}
+	return result, nil
+}
+
+// complexity counts the decision points of body plus one. Function literals
+// count towards the function they are declared in.
+func complexity(body *ast.BlockStmt) int {
+	n := 1
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt:
+			n++
+		case *ast.CaseClause:
+			// the default case is not a decision
+			if node.List != nil {
+				n++
+			}
+		case *ast.CommClause:
+			if node.Comm != nil {
+				n++
+			}
+		case *ast.BinaryExpr:
+			if node.Op == token.LAND || node.Op == token.LOR {
+				n++
+			}
+		}
+		return true
+	})
+	return n
+}
+
+// WriteComplexity prints the complexities, one per line
+func WriteComplexity(w io.Writer, fname string, result []DeclComplexity) {
+	if fname == "" {
+		fname = "<stdin>"
+	}
+	for _, c := range result {
+		fmt.Fprintf(w, "%s:%d: %d %s\n", fname, c.Line, c.Complexity, c.Decl)
+	}
+}
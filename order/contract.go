@@ -0,0 +1,106 @@
+package order
+
+import (
+	"go/ast"
+	"sort"
+)
+
+// interfaceMethods returns the names of the methods of the interface type
+// with the given name, including those of embedded interfaces declared in
+// the same file, in declaration order
+func (s *sorter) interfaceMethods(name string, seen map[string]bool) []string {
+	spec, ok := s.types[name]
+	if !ok || seen[name] {
+		return nil
+	}
+	iface, ok := spec.Type.(*ast.InterfaceType)
+	if !ok {
+		return nil
+	}
+	seen[name] = true
+
+	var methods []string
+	for _, field := range iface.Methods.List {
+		if len(field.Names) == 0 {
+			if ident, ok := field.Type.(*ast.Ident); ok {
+				methods = append(methods, s.interfaceMethods(ident.Name, seen)...)
+			}
+			continue
+		}
+		for _, n := range field.Names {
+			methods = append(methods, n.Name)
+		}
+	}
+	return methods
+}
+
+// contract returns the methods of the first interface, by name, that the
+// receiver implements, in the order the interface declares them
+func (s *sorter) contract(recv string) []string {
+	var names []string
+	for name := range s.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		methods := s.interfaceMethods(name, map[string]bool{})
+		if len(methods) == 0 || name == recv {
+			continue
+		}
+
+		implements := true
+		for _, m := range methods {
+			if _, ok := s.methods[recv][m]; !ok {
+				implements = false
+				break
+			}
+		}
+		if implements {
+			return methods
+		}
+	}
+	return nil
+}
+
+// orderByInterface moves the methods implementing an interface into the
+// order of the interface, reusing the slots they already occupy so that
+// other methods keep their place
+func (s *sorter) orderByInterface(decls []ast.Decl) {
+	for recv := range s.methods {
+		methods := s.contract(recv)
+		if methods == nil {
+			continue
+		}
+
+		index := map[string]int{}
+		for i, m := range methods {
+			if _, ok := index[m]; !ok {
+				index[m] = i
+			}
+		}
+
+		var (
+			slots    []int
+			contract []*ast.FuncDecl
+		)
+		for i, d := range decls {
+			f, ok := d.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			name := funcName(f)
+			if _, ok := index[name.name]; ok && name.recv == recv {
+				slots = append(slots, i)
+				contract = append(contract, f)
+			}
+		}
+
+		sort.SliceStable(contract, func(i, j int) bool {
+			return index[contract[i].Name.Name] < index[contract[j].Name.Name]
+		})
+		for i, slot := range slots {
+			decls[slot] = contract[i]
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package order
+
+import (
+	"bytes"
+	"go/ast"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// directive matches comments like //go:noinline or //lint:ignore, but
+// not regular doc text
+var directive = regexp.MustCompile(`^//[a-z0-9]+:[a-z0-9]`)
+
+// directiveRank orders the directives of a doc comment: go pragmas first,
+// then linter directives. The doc text comes before them all.
+func directiveRank(text string) int {
+	switch {
+	case strings.HasPrefix(text, "//go:"):
+		return 0
+	case strings.HasPrefix(text, "//nolint"), directive.MatchString(text):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// sortDirectives moves the directives of every declaration's doc comment
+// below its text, separated by an empty // line, as gofmt does, and orders
+// them by directiveRank, keeping the order of those with the same rank
+func sortDirectives(tree *ast.File, contents []byte, comments map[ast.Decl][]byte) {
+	for _, d := range tree.Decls {
+		var doc *ast.CommentGroup
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			doc = d.Doc
+		case *ast.GenDecl:
+			doc = d.Doc
+		}
+		if doc == nil || len(doc.List) < 2 {
+			continue
+		}
+
+		lines := make([]string, len(doc.List))
+		for i, c := range doc.List {
+			// leave block comments alone
+			if !strings.HasPrefix(c.Text, "//") {
+				lines = nil
+				break
+			}
+			lines[i] = c.Text
+		}
+		if lines == nil {
+			continue
+		}
+
+		var text, directives []string
+		for _, line := range lines {
+			if directiveRank(line) < 2 {
+				directives = append(directives, line)
+			} else {
+				text = append(text, line)
+			}
+		}
+		if len(directives) == 0 {
+			continue
+		}
+		sort.SliceStable(directives, func(i, j int) bool {
+			return directiveRank(directives[i]) < directiveRank(directives[j])
+		})
+		for len(text) > 0 && strings.TrimSpace(text[len(text)-1]) == "//" {
+			text = text[:len(text)-1]
+		}
+		if len(text) > 0 {
+			text = append(text, "//")
+		}
+		lines = append(text, directives...)
+
+		original := contents[doc.Pos()-1 : commentEnd(contents, doc)]
+		i := bytes.LastIndex(comments[d], original)
+		if i < 0 {
+			continue
+		}
+		sorted := []byte(strings.Join(lines, "\n"))
+		comments[d] = append(append(append([]byte{}, comments[d][:i]...), sorted...), comments[d][i+len(original):]...)
+	}
+}
+
+// glueStickyComments moves comments starting with one of prefixes out of the
+// file header, back to the declaration below them
+func glueStickyComments(tree *ast.File, contents []byte, comments map[ast.Decl][]byte, prefixes []string) {
+	if len(tree.Decls) == 0 {
+		return
+	}
+
+	var glued []byte
+	for _, c := range tree.Comments {
+		if c.Pos() < tree.Package || !isFileDirective(tree, c) || !hasAnyPrefix(c.List[0].Text, prefixes) {
+			continue
+		}
+
+		text := commentWithNewlines(contents, c)
+		i := bytes.Index(comments[fileHeader], text)
+		if i < 0 {
+			continue
+		}
+		header := comments[fileHeader]
+		comments[fileHeader] = append(header[:i:i], header[i+len(text):]...)
+		glued = append(glued, text...)
+	}
+
+	first := tree.Decls[0]
+	comments[first] = append(glued, comments[first]...)
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
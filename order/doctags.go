@@ -0,0 +1,40 @@
+package order
+
+import (
+	"go/ast"
+	"strings"
+)
+
+// docTag returns the bracketed tag leading the doc comment of d, e.g. "API"
+// for "// [API] Serve handles requests", or "" if there is none
+func docTag(d ast.Decl) string {
+	var doc *ast.CommentGroup
+	switch d := d.(type) {
+	case *ast.FuncDecl:
+		doc = d.Doc
+	case *ast.GenDecl:
+		doc = d.Doc
+	}
+	if doc == nil {
+		return ""
+	}
+
+	text := strings.TrimSpace(strings.TrimPrefix(doc.List[0].Text, "//"))
+	if !strings.HasPrefix(text, "[") {
+		return ""
+	}
+	end := strings.Index(text, "]")
+	if end < 0 {
+		return ""
+	}
+	return strings.TrimSpace(text[1:end])
+}
+
+// tagRank returns the position of the doc tag of d in Config.DocTagOrder,
+// untagged declarations and unknown tags go last
+func (s *sorter) tagRank(d ast.Decl) int {
+	if rank, ok := s.tags[docTag(d)]; ok {
+		return rank
+	}
+	return len(s.tags)
+}
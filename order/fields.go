@@ -0,0 +1,84 @@
+package order
+
+import "go/ast"
+
+// indexFields records, for each method touching exactly one field of its
+// struct receiver, the position of that field in the struct
+func (s *sorter) indexFields() {
+	for recv, methods := range s.methods {
+		fields := s.fieldIndex(recv)
+		if len(fields) == 0 {
+			continue
+		}
+		for _, m := range methods {
+			if i, ok := touchedField(m, fields); ok {
+				s.fields[m] = i
+			}
+		}
+	}
+}
+
+// fieldIndex returns the position of each field of the struct type with the
+// given name, embedded fields are named after their type
+func (s *sorter) fieldIndex(name string) map[string]int {
+	spec, ok := s.types[name]
+	if !ok {
+		return nil
+	}
+	st, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		return nil
+	}
+
+	index := map[string]int{}
+	for i, field := range st.Fields.List {
+		for _, name := range field.Names {
+			index[name.Name] = i
+		}
+		if len(field.Names) == 0 {
+			typ := field.Type
+			if star, ok := typ.(*ast.StarExpr); ok {
+				typ = star.X
+			}
+			switch typ := typ.(type) {
+			case *ast.Ident:
+				index[typ.Name] = i
+			case *ast.SelectorExpr:
+				index[typ.Sel.Name] = i
+			}
+		}
+	}
+	return index
+}
+
+// touchedField returns the position of the only field that m selects on its
+// receiver, ok is false if it selects none or several
+func touchedField(m *ast.FuncDecl, fields map[string]int) (field int, ok bool) {
+	names := m.Recv.List[0].Names
+	if m.Body == nil || len(names) == 0 || names[0].Name == "_" {
+		return 0, false
+	}
+	recv := names[0].Name
+
+	field = -1
+	several := false
+	ast.Inspect(m.Body, func(n ast.Node) bool {
+		sel, isSel := n.(*ast.SelectorExpr)
+		if !isSel {
+			return true
+		}
+		if x, isIdent := sel.X.(*ast.Ident); !isIdent || x.Name != recv {
+			return true
+		}
+		i, isField := fields[sel.Sel.Name]
+		if !isField {
+			return true
+		}
+		if field >= 0 && field != i {
+			several = true
+		}
+		field = i
+		return true
+	})
+	return field, field >= 0 && !several
+}
@@ -0,0 +1,23 @@
+package order
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// DeclFingerprints maps every declaration of src, identified by its kind,
+// receiver and name such as "func Foo.String", to a SHA-256 hash of its
+// source. Identical declarations in different files get the same hash.
+func DeclFingerprints(src []byte) (map[string]string, error) {
+	decls, err := declContents(src, Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprints := make(map[string]string, len(decls.text))
+	for key, text := range decls.text {
+		sum := sha256.Sum256(text)
+		fingerprints[key] = hex.EncodeToString(sum[:])
+	}
+	return fingerprints, nil
+}
@@ -0,0 +1,114 @@
+package order
+
+import (
+	"fmt"
+	"go/ast"
+	"html/template"
+	"io"
+	"sort"
+)
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>go-order: {{.Name}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; width: 100%; table-layout: fixed; }
+td { vertical-align: top; border: 1px solid #ddd; }
+pre { margin: 0; padding: 0.5em; white-space: pre-wrap; }
+.moved { background: #fff3b0; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<table>
+<tr><th>Before</th><th>After</th></tr>
+<tr>
+<td>{{range .Before}}<pre{{if .Moved}} class="moved"{{end}}>{{.Text}}</pre>{{end}}</td>
+<td>{{range .After}}<pre{{if .Moved}} class="moved"{{end}}>{{.Text}}</pre>{{end}}</td>
+</tr>
+</table>
+</body>
+</html>
+`))
+
+type reportBlock struct {
+	Text  string
+	Moved bool
+}
+
+// HTMLReport writes a self-contained HTML page showing the file before and
+// after sorting side by side, with moved declarations highlighted
+func HTMLReport(w io.Writer, name string, contents []byte, config Config) error {
+	fset, tree, comments, err := parseFile(contents)
+	if err != nil {
+		return err
+	}
+
+	before := append([]ast.Decl{}, tree.Decls...)
+	if err := sortAST(fset, tree, config); err != nil {
+		return fmt.Errorf("failed to sort AST: %w", err)
+	}
+	moved := movedDecls(before, tree.Decls)
+
+	blocks := func(decls []ast.Decl) []reportBlock {
+		var blocks []reportBlock
+		for _, d := range decls {
+			text := string(comments[d]) + string(contents[d.Pos()-1:d.End()-1])
+			blocks = append(blocks, reportBlock{Text: text, Moved: moved[d]})
+		}
+		return blocks
+	}
+
+	if name == "" {
+		name = "<stdin>"
+	}
+	return reportTemplate.Execute(w, map[string]any{
+		"Name":   name,
+		"Before": blocks(before),
+		"After":  blocks(tree.Decls),
+	})
+}
+
+// movedDecls returns the declarations that had to move to get from before
+// to after: everything outside the longest run of declarations that kept
+// their relative order
+func movedDecls(before, after []ast.Decl) map[ast.Decl]bool {
+	index := make(map[ast.Decl]int, len(before))
+	for i, d := range before {
+		index[d] = i
+	}
+
+	// longest increasing subsequence of original positions, in O(n log n)
+	var (
+		tails = []int{}                 // positions in after ending each run
+		prev  = make([]int, len(after)) // previous element of each run
+	)
+	for i, d := range after {
+		j := sort.Search(len(tails), func(k int) bool {
+			return index[after[tails[k]]] >= index[d]
+		})
+		prev[i] = -1
+		if j > 0 {
+			prev[i] = tails[j-1]
+		}
+		if j == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[j] = i
+		}
+	}
+
+	moved := make(map[ast.Decl]bool, len(after))
+	for _, d := range after {
+		moved[d] = true
+	}
+	if len(tails) > 0 {
+		for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+			delete(moved, after[i])
+		}
+	}
+	return moved
+}
@@ -0,0 +1,265 @@
+package order
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// normalizeImports merges multiple import declarations into a single
+// parenthesized block, taking the place of the first one
+func normalizeImports(contents []byte) ([]byte, error) {
+	_, tree, _, err := parseFile(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	var imports []*ast.GenDecl
+	for _, d := range tree.Decls {
+		if d, ok := d.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			imports = append(imports, d)
+		}
+	}
+	if len(imports) < 2 {
+		return contents, nil
+	}
+
+	block := &bytes.Buffer{}
+	block.WriteString("import (\n")
+	for _, d := range imports {
+		if d.Doc != nil {
+			for _, c := range d.Doc.List {
+				block.WriteString("\t" + c.Text + "\n")
+			}
+		}
+
+		if d.Lparen.IsValid() {
+			inner := bytes.Trim(contents[d.Lparen:d.Rparen-1], "\n")
+			if len(inner) > 0 {
+				block.Write(inner)
+				block.WriteByte('\n')
+			}
+			continue
+		}
+
+		spec := d.Specs[0].(*ast.ImportSpec)
+		end := spec.End()
+		if spec.Comment != nil {
+			end = spec.Comment.End()
+		}
+		block.WriteByte('\t')
+		block.Write(contents[spec.Pos()-1 : end-1])
+		block.WriteByte('\n')
+	}
+	block.WriteString(")")
+
+	// replace the declarations back to front to keep offsets valid
+	sort.Slice(imports, func(i, j int) bool {
+		return imports[i].Pos() > imports[j].Pos()
+	})
+
+	out := append([]byte{}, contents...)
+	for i, d := range imports {
+		start, end := int(d.Pos())-1, int(d.End())-1
+		if d.Doc != nil {
+			start = int(d.Doc.Pos()) - 1
+		}
+
+		var replacement []byte
+		if i == len(imports)-1 {
+			replacement = block.Bytes()
+		} else {
+			// swallow the blank lines that followed the declaration
+			for end < len(out) && out[end] == '\n' {
+				end++
+			}
+		}
+
+		out = append(out[:start], append(replacement, out[end:]...)...)
+	}
+
+	return out, nil
+}
+
+// blankImportsLast moves the blank identifier imports of every import block
+// into their own group at the bottom, keeping their relative order
+func blankImportsLast(contents []byte) ([]byte, error) {
+	_, tree, _, err := parseFile(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	var edits []edit
+	for _, d := range tree.Decls {
+		d, ok := d.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT || !d.Lparen.IsValid() {
+			continue
+		}
+
+		start := int(d.Lparen)
+		if i := bytes.IndexByte(contents[start:], '\n'); i >= 0 {
+			start += i + 1
+		}
+		end := bytes.LastIndexByte(contents[:d.Rparen-1], '\n') + 1
+		if start > end {
+			continue
+		}
+
+		var (
+			rest, blank []byte
+			prev        = start
+			valid       = true
+		)
+		for i, spec := range d.Specs {
+			spec := spec.(*ast.ImportSpec)
+			if spec.Name == nil || spec.Name.Name != "_" {
+				continue
+			}
+			c, ok := elementChunk(contents, i, spec.Doc, spec, spec.Comment)
+			if !ok {
+				valid = false
+				break
+			}
+			rest = append(rest, contents[prev:c.start]...)
+			blank = append(blank, contents[c.start:c.end]...)
+			prev = c.end
+		}
+		if !valid || len(blank) == 0 {
+			continue
+		}
+		rest = append(rest, contents[prev:end]...)
+
+		// drop the blank lines left behind by the moved imports
+		var lines [][]byte
+		for _, line := range bytes.SplitAfter(rest, []byte("\n")) {
+			empty := len(bytes.TrimSpace(line)) == 0
+			if empty && (len(lines) == 0 || len(bytes.TrimSpace(lines[len(lines)-1])) == 0) {
+				continue
+			}
+			lines = append(lines, line)
+		}
+		for len(lines) > 0 && len(bytes.TrimSpace(lines[len(lines)-1])) == 0 {
+			lines = lines[:len(lines)-1]
+		}
+
+		body := bytes.Join(lines, nil)
+		if len(body) > 0 {
+			body = append(body, '\n')
+		}
+		body = append(body, blank...)
+
+		if !bytes.Equal(body, contents[start:end]) {
+			edits = append(edits, edit{start: start, end: end, text: body})
+		}
+	}
+
+	return applyEdits(contents, edits), nil
+}
+
+// sortImports sorts the specs of parenthesized import blocks by path. Groups
+// separated by blank lines are sorted on their own, unless the block is
+// regrouped by Config.MergeImportGroups or Config.GroupImports. Blocks with
+// free standing comments are never regrouped.
+func sortImports(contents []byte, config Config) ([]byte, error) {
+	_, tree, _, err := parseFile(contents)
+	if err != nil {
+		return nil, err
+	}
+	grouped := config.GroupImports || config.LocalImportPrefix != ""
+	regroup := grouped || config.MergeImportGroups
+
+	var edits []edit
+	for _, d := range tree.Decls {
+		d, ok := d.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT || !d.Lparen.IsValid() {
+			continue
+		}
+
+		var (
+			chunks = make([]chunk, 0, len(d.Specs))
+			paths  = make([]string, len(d.Specs))
+		)
+		for i, spec := range d.Specs {
+			spec := spec.(*ast.ImportSpec)
+			paths[i], _ = strconv.Unquote(spec.Path.Value)
+			c, ok := elementChunk(contents, i, spec.Doc, spec, spec.Comment)
+			if !ok {
+				chunks = nil
+				break
+			}
+			chunks = append(chunks, c)
+		}
+		less := func(a, b int) bool {
+			return paths[a] < paths[b]
+		}
+
+		if regroup && len(chunks) > 0 && onlyBlankLinesBetween(contents, chunks) {
+			sorted := append([]chunk{}, chunks...)
+			sort.SliceStable(sorted, func(i, j int) bool {
+				return less(sorted[i].index, sorted[j].index)
+			})
+
+			groups := make([][]byte, 3)
+			for _, c := range sorted {
+				g := 0
+				if grouped {
+					g = importGroup(paths[c.index], config.LocalImportPrefix)
+				}
+				groups[g] = append(groups[g], contents[c.start:c.end]...)
+			}
+			var body []byte
+			for _, g := range groups {
+				if len(g) == 0 {
+					continue
+				}
+				if len(body) > 0 {
+					body = append(body, '\n')
+				}
+				body = append(body, g...)
+			}
+
+			start, end := chunks[0].start, chunks[len(chunks)-1].end
+			if !bytes.Equal(body, contents[start:end]) {
+				edits = append(edits, edit{start: start, end: end, text: body})
+			}
+			continue
+		}
+
+		if config.SortImports {
+			edits = append(edits, sortChunks(contents, chunks, less)...)
+		}
+	}
+
+	return applyEdits(contents, edits), nil
+}
+
+// importGroup returns 0 for standard library packages, 2 for packages of
+// the local module and 1 for all others, going by the path alone
+func importGroup(p, local string) int {
+	local = strings.TrimSuffix(local, "/")
+	if local != "" && (p == local || strings.HasPrefix(p, local+"/")) {
+		return 2
+	}
+	first := p
+	if i := strings.IndexByte(p, '/'); i >= 0 {
+		first = p[:i]
+	}
+	if strings.Contains(first, ".") {
+		return 1
+	}
+	return 0
+}
+
+// onlyBlankLinesBetween reports whether nothing but blank lines separates
+// the chunks
+func onlyBlankLinesBetween(contents []byte, chunks []chunk) bool {
+	for i := 1; i < len(chunks); i++ {
+		if len(bytes.TrimSpace(contents[chunks[i-1].end:chunks[i].start])) > 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package order
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// assignedVars returns the package level vars that body assigns to, either
+// directly or through an index or field, e.g. handlers["x"] = h
+func assignedVars(body *ast.BlockStmt, vars map[string]ast.Decl) []ast.Decl {
+	var assigned []ast.Decl
+	ast.Inspect(body, func(n ast.Node) bool {
+		assign, ok := n.(*ast.AssignStmt)
+		if !ok || assign.Tok == token.DEFINE {
+			return true
+		}
+		for _, lhs := range assign.Lhs {
+			for {
+				switch e := lhs.(type) {
+				case *ast.IndexExpr:
+					lhs = e.X
+					continue
+				case *ast.SelectorExpr:
+					lhs = e.X
+					continue
+				case *ast.StarExpr:
+					lhs = e.X
+					continue
+				}
+				break
+			}
+			if ident, ok := lhs.(*ast.Ident); ok {
+				if d, ok := vars[ident.Name]; ok {
+					assigned = append(assigned, d)
+				}
+			}
+		}
+		return true
+	})
+	return assigned
+}
+
+// pairInitWithVars moves every init function right after the last package
+// level var it populates. Go runs init functions in source order, so one
+// that would move above the init before it goes right below that instead.
+// Local variables shadowing the vars are not detected.
+func pairInitWithVars(decls []ast.Decl) {
+	vars := map[string]ast.Decl{}
+	var inits []*ast.FuncDecl
+	for _, d := range decls {
+		switch d := d.(type) {
+		case *ast.GenDecl:
+			if d.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range d.Specs {
+				for _, name := range spec.(*ast.ValueSpec).Names {
+					vars[name.Name] = d
+				}
+			}
+		case *ast.FuncDecl:
+			if entrypoint(d) == 1 && d.Body != nil {
+				inits = append(inits, d)
+			}
+		}
+	}
+
+	index := func(d ast.Decl) int {
+		for i, each := range decls {
+			if each == d {
+				return i
+			}
+		}
+		return -1
+	}
+
+	var previous ast.Decl
+	for _, f := range inits {
+		var anchor ast.Decl
+		for _, v := range assignedVars(f.Body, vars) {
+			if anchor == nil || index(v) > index(anchor) {
+				anchor = v
+			}
+		}
+		if previous != nil {
+			if anchor == nil && index(f) < index(previous) || anchor != nil && index(anchor) < index(previous) {
+				anchor = previous
+			}
+		}
+		previous = f
+		if anchor == nil {
+			continue
+		}
+
+		from := index(f)
+		copy(decls[from:], decls[from+1:])
+		to := index(anchor) + 1
+		copy(decls[to+1:], decls[to:len(decls)-1])
+		decls[to] = f
+	}
+}
@@ -0,0 +1,107 @@
+package order
+
+import (
+	"go/ast"
+	"strings"
+)
+
+// sortMembers sorts the fields of every struct type if structs is set and
+// the methods of every interface type if interfaces is set, by name.
+// Embedded fields and interfaces go first in their original order. Like
+// specs, members separated by blank lines or comments are sorted as separate
+// groups. Structs built with unkeyed composite literals in the file are left
+// alone since those depend on the order of the fields.
+func sortMembers(contents []byte, structs, interfaces bool) ([]byte, error) {
+	// nested types are sorted once their parent is done, so that edits
+	// never overlap
+	for {
+		_, tree, _, err := parseFile(contents)
+		if err != nil {
+			return nil, err
+		}
+
+		names, literals := unkeyedStructs(tree)
+		var edits []edit
+		ast.Inspect(tree, func(n ast.Node) bool {
+			var members *ast.FieldList
+			switch n := n.(type) {
+			case *ast.TypeSpec:
+				// only structs are built with literals
+				return !structs || !names[n.Name.Name]
+			case *ast.StructType:
+				if !structs || literals[n] {
+					return true
+				}
+				members = n.Fields
+			case *ast.InterfaceType:
+				if !interfaces {
+					return true
+				}
+				members = n.Methods
+			default:
+				return true
+			}
+			sorted := sortFields(contents, members)
+			edits = append(edits, sorted...)
+			return len(sorted) == 0
+		})
+		if len(edits) == 0 {
+			return contents, nil
+		}
+		contents = applyEdits(contents, edits)
+	}
+}
+
+// sortFields returns the edits sorting the fields of a single struct or the
+// methods of a single interface
+func sortFields(contents []byte, fields *ast.FieldList) []edit {
+	var (
+		chunks = make([]chunk, 0, len(fields.List))
+		names  = make([]string, len(fields.List))
+	)
+	for i, field := range fields.List {
+		if len(field.Names) > 0 {
+			names[i] = field.Names[0].Name
+		}
+		c, ok := elementChunk(contents, i, field.Doc, field, field.Comment)
+		if !ok {
+			return nil
+		}
+		chunks = append(chunks, c)
+	}
+
+	return sortChunks(contents, chunks, func(a, b int) bool {
+		// embedded fields and interfaces have no name and keep their order
+		if (names[a] == "") != (names[b] == "") {
+			return names[a] == ""
+		}
+		return strings.Compare(names[a], names[b]) < 0
+	})
+}
+
+// unkeyedStructs returns the names of the types and the struct literal types
+// built with unkeyed composite literals, e.g. Point{1, 2}
+func unkeyedStructs(tree *ast.File) (names map[string]bool, literals map[*ast.StructType]bool) {
+	names, literals = map[string]bool{}, map[*ast.StructType]bool{}
+	ast.Inspect(tree, func(n ast.Node) bool {
+		lit, ok := n.(*ast.CompositeLit)
+		if !ok || len(lit.Elts) == 0 {
+			return true
+		}
+		if _, ok := lit.Elts[0].(*ast.KeyValueExpr); ok {
+			return true
+		}
+		typ := lit.Type
+		if star, ok := typ.(*ast.StarExpr); ok {
+			typ = star.X
+		}
+		switch typ := typ.(type) {
+		case *ast.Ident:
+			names[typ.Name] = true
+		case *ast.StructType:
+			literals[typ] = true
+		}
+		return true
+	})
+	return names, literals
+}
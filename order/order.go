@@ -0,0 +1,926 @@
+// Package order reorders the declarations of go source files: imports
+// first, then constants, variables, types and functions, with methods
+// grouped by receiver.
+package order
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// order is the default order of declaration kinds, see Config.Order
+var order = map[token.Token]int{
+	token.IMPORT: 0,
+	token.CONST:  1,
+	token.VAR:    2,
+	token.TYPE:   3,
+	token.FUNC:   4,
+}
+
+// ParseOrder parses a comma separated list of all declaration kinds, e.g.
+// "import,type,const,var,func", into an order for Config.Order
+func ParseOrder(s string) (map[token.Token]int, error) {
+	result := map[token.Token]int{}
+	for i, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		tok := token.Lookup(name)
+		if _, ok := order[tok]; !ok {
+			return nil, fmt.Errorf("unknown declaration kind %q: must be one of import, const, var, type or func", name)
+		}
+		if _, ok := result[tok]; ok {
+			return nil, fmt.Errorf("declaration kind %q is listed twice", name)
+		}
+		result[tok] = i
+	}
+	for tok := range order {
+		if _, ok := result[tok]; !ok {
+			return nil, fmt.Errorf("declaration kind %q is missing", tok)
+		}
+	}
+	if result[token.IMPORT] != 0 {
+		return nil, errors.New("imports must come first")
+	}
+	return result, nil
+}
+
+// DefaultMethodPriority keeps common marshal and unmarshal pairs together,
+// marshal first
+var DefaultMethodPriority = []string{
+	"MarshalJSON", "UnmarshalJSON",
+	"MarshalText", "UnmarshalText",
+	"MarshalBinary", "UnmarshalBinary",
+}
+
+// Tiebreaks between a function and a method with the same name
+const (
+	MethodFirst = "method-first"
+	FuncFirst   = "func-first"
+)
+
+// Config holds the options of Order. The zero value only groups
+// declarations by kind, keeping their relative order.
+type Config struct {
+	// SortAlphabetically sorts declarations of the same kind by name
+	SortAlphabetically bool `desc:"sort declarations of the same kind alphabetically"`
+
+	// ExportedFirst lists exported consts, vars, types, functions and methods
+	// before the unexported ones of the same kind when sorting
+	// alphabetically. Methods stay grouped by receiver.
+	ExportedFirst bool `desc:"list exported declarations before unexported ones of the same kind"`
+
+	// SortKey lists the comparators names are sorted with, each breaking
+	// the ties of the previous one: "natural" compares numbers by value,
+	// "case-insensitive" ignores case and "export" lists exported names
+	// first. Names equal under all of them are compared byte by byte.
+	SortKey []string `desc:"comparators for names, in order: natural, case-insensitive, export"`
+
+	// WriteToFile writes the result back to the file instead of stdout. It
+	// is only used by the command line.
+	WriteToFile bool `desc:"write the result back to the file instead of stdout"`
+
+	// Order overrides the order of the declaration kinds, see ParseOrder.
+	// The default lists imports, constants, variables, types and functions.
+	Order map[token.Token]int `desc:"position of each declaration kind, by token"`
+
+	// MirrorEmbeddedOrder lists methods that override a method of an embedded
+	// type first, in the same order as the embedded type's methods
+	MirrorEmbeddedOrder bool `desc:"list methods overriding an embedded type's methods first, in its order"`
+
+	// MethodPriority lists method names that go first within the methods of
+	// a receiver, in the given order. Defaults to DefaultMethodPriority when nil.
+	MethodPriority []string `desc:"method names to list first for each receiver, null for the default list"`
+
+	// PriorityMethodPattern is a regular expression, e.g. "^Handle", for
+	// methods that go first within the methods of a receiver, sorted by
+	// name and before those of MethodPriority
+	PriorityMethodPattern string `desc:"regular expression for method names to list first for each receiver"`
+
+	// MethodsByCallOrder names an orchestrating method, e.g. "Run". Receivers
+	// with that method list it first, followed by the methods it calls in the
+	// order they are first called.
+	MethodsByCallOrder string `desc:"method whose callees follow it in call order, e.g. Run"`
+
+	// DeprecatedMethodsLast lists the methods of a receiver marked with
+	// "Deprecated: " in their doc after the others
+	DeprecatedMethodsLast bool `desc:"list deprecated methods last within their receiver"`
+
+	// SentinelErrorsFirst lists vars like ErrNotFound = errors.New(...) before
+	// all other vars, sorted by name
+	SentinelErrorsFirst bool `desc:"list sentinel error vars first"`
+
+	// InterfacesFirst lists interface types before all other types
+	InterfacesFirst bool `desc:"list interfaces before other types"`
+
+	// TypesWithMethodsFirst lists types with methods declared in the file
+	// before plain data types without any
+	TypesWithMethodsFirst bool `desc:"list types with methods before types without"`
+
+	// MocksAfterInterface lists test doubles such as MockStore, FakeStore or
+	// StubStore right after the type they stand in for
+	MocksAfterInterface bool `desc:"list mocks, fakes and stubs right after the type they stand in for"`
+
+	// GenericFuncsLast lists generic functions after all other functions
+	GenericFuncsLast bool `desc:"list generic functions after the others"`
+
+	// SameNameTiebreak decides where a function goes when it shares its name
+	// with a method. With MethodFirst, the default, it stays with the other
+	// functions after all methods. With FuncFirst it goes right before the
+	// method.
+	SameNameTiebreak string `desc:"where a function sharing its name with a method goes: method-first or func-first"`
+
+	// RouteOrder lists handler functions, or methods as "Server.handleIndex",
+	// in the order their routes are registered. They go first, in that order.
+	RouteOrder []string `desc:"handler names in the order of their routes"`
+
+	// PreserveBuilderOrder keeps methods returning their receiver type, such
+	// as the methods of a fluent builder, first and in their original order
+	PreserveBuilderOrder bool `desc:"keep fluent builder methods returning the receiver first, in source order"`
+
+	// ContractMethodsFirst lists the methods implementing an interface
+	// declared in the file first, in the order of the interface, and the
+	// other methods of the receiver after them
+	ContractMethodsFirst bool `desc:"list methods implementing an interface first, in its order"`
+
+	// PairInitWithVar moves init functions right after the package level
+	// vars they populate
+	PairInitWithVar bool `desc:"keep init functions right after the vars they populate"`
+
+	// MainPackageOrdering keeps init and main last only in package main. In
+	// other packages init goes before all other functions, so that the
+	// package setup is read first, and main is an ordinary function.
+	MainPackageOrdering bool `desc:"list init first outside of package main"`
+
+	// BookendMethods lists methods like NewSession, Init, Open or Start
+	// first within their receiver and Close, Shutdown and Stop last
+	BookendMethods bool `desc:"list setup methods first and Close, Shutdown and Stop last within their receiver"`
+
+	// ContextVariantsAdjacent lists a XContext function or method right
+	// after X, e.g. QueryContext after Query
+	ContextVariantsAdjacent bool `desc:"list XContext variants right after X"`
+
+	// GroupMethodsWithType lists the methods of each type right below the
+	// type instead of after all other declarations. Methods of types
+	// declared in another file stay with the functions. The const block of
+	// an enum with a String method moves along, right above String.
+	GroupMethodsWithType bool `desc:"list the methods of each type right below it"`
+
+	// ConstructorsWithType lists constructors like NewFoo or newFoo right
+	// below the declaration of Foo, before its methods if those are grouped
+	// with it too
+	ConstructorsWithType bool `desc:"list NewFoo constructors right below type Foo"`
+
+	// BlankLinesBetweenReceivers is the number of blank lines between the
+	// methods of one receiver and the next declaration starting another
+	// receiver's block. 0 keeps the usual single blank line. Gofmt collapses
+	// them back into one.
+	BlankLinesBetweenReceivers int `desc:"blank lines between the method blocks of different receivers, 0 for one"`
+
+	// PreserveSpacing keeps declarations that were tightly packed, without
+	// blank lines between them, packed after sorting. Other declarations
+	// are followed by as many blank lines as followed them, or the group
+	// they were packed in, instead of a single one.
+	PreserveSpacing bool `desc:"keep tightly packed declarations packed and the blank lines after others"`
+
+	// MethodsByField groups the methods of a struct by the field they
+	// select on the receiver, in the order of the fields. Methods touching
+	// several fields or none go after them.
+	MethodsByField bool `desc:"group methods by the receiver field they touch, in field order"`
+
+	// GroupVarsByType groups vars by their declared type, sorted by type and
+	// then by name. Vars without a declared type go last.
+	GroupVarsByType bool `desc:"group vars by their declared type"`
+
+	// MethodOrderFromInterface orders the methods a type uses to implement
+	// an interface declared in the same file like the interface declares them
+	MethodOrderFromInterface bool `desc:"order methods implementing an interface like the interface"`
+
+	// TypeAliasesLast lists type aliases (type A = B) after all other types
+	TypeAliasesLast bool `desc:"list type aliases after other types"`
+
+	// NormalizeImports merges separate import declarations into a single
+	// parenthesized block
+	NormalizeImports bool `desc:"merge import declarations into a single block"`
+
+	// SortImports sorts the specs of import blocks by path. Groups separated
+	// by blank lines are sorted on their own unless MergeImportGroups or
+	// GroupImports regroup them.
+	SortImports bool `desc:"sort import specs by path"`
+
+	// MergeImportGroups sorts import blocks as a single group, dropping the
+	// blank lines between groups, see SortImports
+	MergeImportGroups bool `desc:"sort import blocks as a single group"`
+
+	// GroupImports sorts import blocks into a group of standard library
+	// packages and a group of all others, like goimports. Packages starting
+	// with LocalImportPrefix, which implies GroupImports, get a third group.
+	GroupImports bool `desc:"group imports into standard library and other packages"`
+
+	// LocalImportPrefix is the import path prefix of the local module, see
+	// GroupImports
+	LocalImportPrefix string `desc:"import path prefix grouped after other packages, e.g. example.com/me"`
+
+	// Taxonomy groups the declarations of each kind into categories, in the
+	// given order. Declarations matching no category go last.
+	Taxonomy []Category `desc:"categories to group declarations by, in order"`
+
+	// DocTagOrder groups declarations by the bracketed tag leading their doc
+	// comment, e.g. "// [API] ...", in this order. Untagged ones go last.
+	DocTagOrder []string `desc:"doc comment tags, e.g. API, to group declarations by, in order"`
+
+	// Strict fails on style issues that reordering makes more visible, such
+	// as methods of one type using different receiver names
+	Strict bool `desc:"fail on inconsistent receiver names"`
+
+	// SortDirectives reorders the doc comment of each declaration so that the
+	// doc text comes first, like gofmt formats it, followed by go pragmas and
+	// then linter directives
+	SortDirectives bool `desc:"list //go: and then //nolint directives after the doc text"`
+
+	// StickyCommentPrefixes lists comment prefixes such as "//revive:" that
+	// always move with the declaration below them, even when a blank line
+	// would otherwise make them a file level directive
+	StickyCommentPrefixes []string `desc:"comment prefixes that always move with the declaration below"`
+
+	// BlankImportsLast moves blank identifier imports, which are only there
+	// for their side effects, into their own group at the bottom of the
+	// import block
+	BlankImportsLast bool `desc:"group blank identifier imports at the bottom of the import block"`
+
+	// SortSpecs sorts the specs within const, var and type blocks by name
+	SortSpecs bool `desc:"sort specs within const, var and type blocks"`
+
+	// DocumentedSpecsFirst sorts the specs within blocks like SortSpecs, but
+	// lists specs with a comment before the others
+	DocumentedSpecsFirst bool `desc:"sort specs within blocks, commented ones first"`
+
+	// SortStructFields sorts the fields of struct types by name, embedded
+	// fields first. Types built with unkeyed literals in the same file are
+	// left alone, other files are not checked.
+	SortStructFields bool `desc:"sort struct fields by name, embedded fields first"`
+
+	// SortInterfaceMethods sorts the methods of interface types by name,
+	// embedded interfaces first
+	SortInterfaceMethods bool `desc:"sort interface methods by name, embedded interfaces first"`
+
+	// NormalizeBuildTags sorts the operands of the build constraint, e.g.
+	// "linux || darwin" becomes "darwin || linux"
+	NormalizeBuildTags bool `desc:"sort the operands of //go:build and // +build lines"`
+
+	// TemplateMode tolerates template placeholders such as {{ .Name }}, for
+	// go files used as code generation templates
+	TemplateMode bool `desc:"tolerate {{ }} template placeholders"`
+
+	// UsePrinter prints every declaration with go/printer instead of copying
+	// its source, so the spacing within declarations is canonical
+	UsePrinter bool `desc:"print declarations with go/printer instead of copying their source"`
+
+	// LockedOrder lists declaration keys, see declKey, in the order they
+	// should keep regardless of the other options. Declarations it does not
+	// list follow the one sorted right before them.
+	LockedOrder []string `desc:"declaration keys in the order to keep"`
+
+	// Renames maps old declaration names to new ones, see ParseRenames. The
+	// keys of LockedOrder and of applied scripts are renamed before they are
+	// matched, so that renamed declarations keep their place.
+	Renames map[string]string `desc:"old declaration names mapped to their new names"`
+
+	// DisorderThreshold, between 0 and 1, leaves files alone unless more
+	// than this fraction of their declarations would move. 0 always sorts.
+	DisorderThreshold float64 `desc:"only sort files where more than this fraction of the declarations would move"`
+
+	// Gofmt formats the output with gofmt
+	Gofmt bool `desc:"format the output with gofmt"`
+
+	// IncludeIgnored sorts files with a "//go:build ignore" constraint, which
+	// are otherwise left untouched
+	IncludeIgnored bool `desc:"also sort files with a //go:build ignore constraint"`
+
+	// IncludeGenerated sorts files marked with a "// Code generated ... DO
+	// NOT EDIT." comment, which are otherwise left untouched
+	IncludeGenerated bool `desc:"also sort generated files"`
+
+	// Verify checks that sorting did not change the content of any
+	// declaration before writing a file
+	Verify bool `desc:"check that no declaration changed before writing"`
+
+	// AssertAPIStable fails if the exported identifiers or their signatures
+	// differ between the original and the sorted file
+	AssertAPIStable bool `desc:"fail if sorting would change the exported API"`
+
+	// OnlyLines, when non-nil, restricts reordering to the declarations
+	// overlapping these lines, e.g. the ones touched by a patch. All others
+	// stay in place.
+	OnlyLines []LineRange `desc:"only reorder declarations overlapping these lines"`
+}
+
+type funcOrMethod struct {
+	name string
+	recv string
+}
+
+// String returns "<receiver type>.<function name>" for methods and the name
+// for functions
+func (f funcOrMethod) String() string {
+	if f.recv == "" {
+		return f.name
+	}
+	return f.recv + "." + f.name
+}
+
+// fileHeader is the key of comments that stay right below the package clause
+var fileHeader ast.Decl = &ast.BadDecl{}
+
+// lineComment is the key of the comment at the end of the line a
+// declaration ends on
+type lineComment struct{ ast.Decl }
+
+// lineComments returns the comment groups starting on the line a
+// declaration outside of them ends on, by declaration
+func lineComments(fset *token.FileSet, tree *ast.File) map[*ast.CommentGroup]ast.Decl {
+	lines := map[*ast.CommentGroup]ast.Decl{}
+	for _, c := range tree.Comments {
+		var last ast.Decl
+		for _, d := range tree.Decls {
+			if d.End() > c.Pos() {
+				if d.Pos() < c.Pos() {
+					last = nil
+				}
+				break
+			}
+			last = d
+		}
+		if last != nil && fset.Position(last.End()).Line == fset.Position(c.Pos()).Line {
+			lines[c] = last
+		}
+	}
+	return lines
+}
+
+// filePreamble is the key of everything above the package clause, such as
+// build constraints, copyright notices and the package doc
+var filePreamble ast.Decl = &ast.BadDecl{}
+
+// fileDirectives are prefixes of comments that apply to the whole file
+var fileDirectives = []string{"//nolint", "//lint:file-ignore"}
+
+// isFileDirective reports whether c is a file level directive such as
+// //nolint:all, placed above the first declaration but not attached to it
+func isFileDirective(tree *ast.File, c *ast.CommentGroup) bool {
+	if len(tree.Decls) == 0 || c.End() > tree.Decls[0].Pos() {
+		return false
+	}
+
+	var doc *ast.CommentGroup
+	switch d := tree.Decls[0].(type) {
+	case *ast.FuncDecl:
+		doc = d.Doc
+	case *ast.GenDecl:
+		doc = d.Doc
+	}
+	if doc == c {
+		return false
+	}
+
+	for _, prefix := range fileDirectives {
+		if strings.HasPrefix(c.List[0].Text, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// commentWithNewlines returns the comment along with the new lines after it
+func commentWithNewlines(content []byte, c *ast.CommentGroup) []byte {
+	// up to and including the new line ending the comment
+	end := commentEnd(content, c) + 1
+	if end > len(content) {
+		end = len(content)
+	}
+	comment := content[c.Pos()-1 : end]
+	for i := end; i < len(content); i++ {
+		if content[i] == '\n' {
+			comment = append(comment, '\n')
+		} else if content[i] != '\r' {
+			break
+		}
+	}
+	return comment
+}
+
+// commentEnd returns the offset in content right after c. The scanner drops
+// carriage returns from the text of comments, so c.End() falls short of it
+// in files with them.
+func commentEnd(content []byte, c *ast.CommentGroup) int {
+	last := c.List[len(c.List)-1]
+	start := int(last.Slash) - 1
+	if strings.HasPrefix(last.Text, "//") {
+		if i := bytes.IndexByte(content[start:], '\n'); i >= 0 {
+			return start + i
+		}
+		return len(content)
+	}
+	if i := bytes.Index(content[start+2:], []byte("*/")); i >= 0 {
+		return start + 2 + i + 2
+	}
+	return int(c.End()) - 1
+}
+
+func assignRootCommentsToDecl(fset *token.FileSet, tree *ast.File, content []byte) map[ast.Decl][]byte {
+	comments := map[ast.Decl][]byte{}
+	if len(tree.Decls) > 0 {
+		// the new line ending the last declaration
+		comments[nil] = []byte{'\n'}
+	}
+	if tree.Package > 1 {
+		comments[filePreamble] = content[:tree.Package-1]
+	}
+
+	lines := lineComments(fset, tree)
+	for _, c := range tree.Comments {
+		start, end := c.Pos(), c.End()
+
+		// skip doc comments
+		if start < tree.Package {
+			continue
+		}
+
+		// comments at the end of the line of a declaration stay there
+		if d := lines[c]; d != nil {
+			comments[lineComment{d}] = content[d.End()-1 : commentEnd(content, c)]
+			continue
+		}
+
+		// skip comments within declarations
+		isRootComment := true
+		for _, d := range tree.Decls {
+			if d.Pos() <= start && end <= d.End() {
+				isRootComment = false
+				break
+			}
+		}
+
+		if !isRootComment {
+			continue
+		}
+
+		// file level directives stay right below the package clause
+		if isFileDirective(tree, c) {
+			comments[fileHeader] = append(comments[fileHeader], commentWithNewlines(content, c)...)
+			continue
+		}
+
+		var found bool
+		for _, d := range tree.Decls {
+			if d.Pos() > c.End() {
+				comments[d] = append(comments[d], commentWithNewlines(content, c)...)
+				found = true
+				break
+			}
+		}
+
+		// the comments after the last declaration are kept as they are,
+		// along with the blank lines between them, up to the end of the file
+		if !found {
+			if len(tree.Decls) > 0 {
+				comments[nil] = append(comments[nil], '\n')
+			}
+			comments[nil] = append(comments[nil], content[start-1:]...)
+			break
+		}
+	}
+
+	return comments
+}
+
+// funcName returns the function name in the form of "<receiver type> <function name>"
+// e.g. funcName("func (f Foo) String() {}") = {recv: "Foo", name: "String"}
+// a function without a receiver
+func funcName(f *ast.FuncDecl) funcOrMethod {
+	name := f.Name.Name
+	if f.Recv == nil || len(f.Recv.List) == 0 {
+		return funcOrMethod{name: name}
+	}
+
+	// unwrap pointers and type parameters down to the base type, e.g.
+	// *Stack[T] and Map[K, V] are methods of Stack and Map
+	var recv string
+	recvType := f.Recv.List[0].Type
+	for recv == "" {
+		switch t := recvType.(type) {
+		case *ast.StarExpr:
+			recvType = t.X
+		case *ast.IndexExpr:
+			recvType = t.X
+		case *ast.IndexListExpr:
+			recvType = t.X
+		case *ast.ParenExpr:
+			recvType = t.X
+		case *ast.Ident:
+			recv = t.Name
+		default:
+			// not valid Go, such as a qualified pkg.T, but it parses
+			recv = types.ExprString(recvType)
+		}
+	}
+
+	return funcOrMethod{recv: recv, name: name}
+}
+
+// startsReceiver reports whether next starts the block of another receiver
+// right after a method of prev's receiver. With GroupMethodsWithType the
+// block of a receiver starts with its type.
+func startsReceiver(prev, next ast.Decl, config Config) bool {
+	p, ok := prev.(*ast.FuncDecl)
+	if !ok || p.Recv == nil {
+		return false
+	}
+	switch next := next.(type) {
+	case *ast.FuncDecl:
+		return next.Recv != nil && funcName(next).recv != funcName(p).recv
+	case *ast.GenDecl:
+		return config.GroupMethodsWithType && next.Tok == token.TYPE
+	}
+	return false
+}
+
+// declKey identifies a declaration by its kind and name, e.g. "type Foo",
+// "func Foo.String" or "var (a, b)" for blocks
+func declKey(d ast.Decl) string {
+	switch d := d.(type) {
+	case *ast.FuncDecl:
+		return "func " + funcName(d).String()
+	case *ast.GenDecl:
+		var names []string
+		for _, spec := range d.Specs {
+			switch spec := spec.(type) {
+			case *ast.ImportSpec:
+				names = append(names, spec.Path.Value)
+			case *ast.TypeSpec:
+				names = append(names, spec.Name.Name)
+			case *ast.ValueSpec:
+				for _, name := range spec.Names {
+					names = append(names, name.Name)
+				}
+			}
+		}
+		if len(names) == 1 && !d.Lparen.IsValid() {
+			return d.Tok.String() + " " + names[0]
+		}
+		return d.Tok.String() + " (" + strings.Join(names, ", ") + ")"
+	default:
+		return ""
+	}
+}
+
+// DeclOrder returns the keys of the declarations of src in order, e.g.
+// "func Foo.String", numbering repeated keys like "func init #2"
+func DeclOrder(src []byte) ([]string, error) {
+	_, tree, _, err := parseFile(src)
+	if err != nil {
+		return nil, err
+	}
+	return declKeys(tree.Decls), nil
+}
+
+// declKeys returns the keys of decls, numbering repeated keys such as
+// multiple init functions so that every key is unique
+func declKeys(decls []ast.Decl) []string {
+	keys := make([]string, len(decls))
+	seen := map[string]int{}
+	for i, d := range decls {
+		key := declKey(d)
+		seen[key]++
+		if n := seen[key]; n > 1 {
+			key = fmt.Sprintf("%s #%d", key, n)
+		}
+		keys[i] = key
+	}
+	return keys
+}
+
+func getToken(d ast.Decl) token.Token {
+	switch d := d.(type) {
+	case *ast.FuncDecl:
+		return token.FUNC
+	case *ast.GenDecl:
+		return d.Tok
+	default:
+		fmt.Printf("bad declaration: %v\n", reflect.TypeOf(d))
+		panic("unimpl for")
+	}
+}
+
+// disorder returns the fraction of declarations that sorting moved out of
+// their slot
+func disorder(before, after []ast.Decl) float64 {
+	if len(before) == 0 {
+		return 0
+	}
+	moved := 0
+	for i := range before {
+		if before[i] != after[i] {
+			moved++
+		}
+	}
+	return float64(moved) / float64(len(before))
+}
+
+func sortAST(fset *token.FileSet, t *ast.File, conf Config) error {
+	s, err := newSorter(t, conf)
+	if err != nil {
+		return err
+	}
+
+	// declarations never cross an //order:barrier comment, and the ones
+	// above an //order:start comment or between go-order:off and
+	// go-order:on comments are not sorted at all
+	regions := offRegions(fset, t)
+	for _, decls := range partition(t.Decls[startIndex(fset, t):], barrierPositions(fset, t)) {
+		if len(decls) > 0 && frozen(decls[0], regions) {
+			continue
+		}
+		if conf.OnlyLines != nil {
+			sortTouched(fset, decls, s, conf.OnlyLines)
+			continue
+		}
+		sort.SliceStable(decls, func(i, j int) bool {
+			return s.less(decls[i], decls[j])
+		})
+
+		if conf.MethodOrderFromInterface {
+			s.orderByInterface(decls)
+		}
+		if conf.ConstructorsWithType || conf.GroupMethodsWithType {
+			groupWithTypes(decls, conf.ConstructorsWithType, conf.GroupMethodsWithType)
+		}
+		if conf.PairInitWithVar {
+			pairInitWithVars(decls)
+		}
+	}
+	return nil
+}
+
+// Order returns src with its declarations reordered according to config
+func Order(src []byte, config Config) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := OrderTo(&buf, src, config); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// OrderTo writes src with its declarations reordered according to config
+// to w. Files that should not be sorted, such as generated ones, are
+// written unchanged.
+func OrderTo(w io.Writer, contents []byte, config Config) error {
+	if config.TemplateMode {
+		return sortTemplate(contents, w, config)
+	}
+
+	f, err := prepare(contents, config)
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		_, err := w.Write(contents)
+		return err
+	}
+
+	if worth, err := f.sort(config); err != nil {
+		return err
+	} else if !worth {
+		_, err := w.Write(contents)
+		return err
+	}
+	return f.output(w, config)
+}
+
+// prepared is a file parsed and rewritten by prepare, with its barrier
+// comments detached from the declarations so that they can be moved
+type prepared struct {
+	fset     *token.FileSet
+	tree     *ast.File
+	contents []byte
+	comments map[ast.Decl][]byte
+	barriers []barrier
+}
+
+// prepare parses contents and rewrites the declarations themselves, ready
+// for them to be moved around. It returns nil for files left alone, such as
+// generated ones, see skipped.
+func prepare(contents []byte, config Config) (*prepared, error) {
+	fset, tree, comments, err := parseFile(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	// leave tool files, generated code and opted out files alone
+	if skipped(tree, config) {
+		return nil, nil
+	}
+
+	// rewrite the declarations themselves before moving them around
+	if rewritten, err := rewrite(contents, config); err != nil {
+		return nil, err
+	} else if !bytes.Equal(rewritten, contents) {
+		contents = keepTop(contents, rewritten)
+		fset, tree, comments, err = parseFile(contents)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(config.StickyCommentPrefixes) > 0 {
+		glueStickyComments(tree, contents, comments, config.StickyCommentPrefixes)
+	}
+
+	if config.SortDirectives {
+		sortDirectives(tree, contents, comments)
+	}
+
+	if config.Strict {
+		if err := checkReceivers(fset, tree); err != nil {
+			return nil, err
+		}
+	}
+
+	return &prepared{
+		fset:     fset,
+		tree:     tree,
+		contents: contents,
+		comments: comments,
+		barriers: detachBarriers(fset, tree, contents, comments),
+	}, nil
+}
+
+// sort sorts the declarations, keeping the locked order if there is one.
+// It reports whether the result is worth the churn, see
+// Config.DisorderThreshold.
+func (f *prepared) sort(config Config) (bool, error) {
+	unsorted := append(f.tree.Decls[:0:0], f.tree.Decls...)
+	if err := sortAST(f.fset, f.tree, config); err != nil {
+		return false, fmt.Errorf("failed to sort AST: %w", err)
+	}
+	if config.LockedOrder != nil {
+		keys := declKeys(f.tree.Decls)
+		reorderByKeys(f.tree, keys, unionOrder(renameKeys(config.LockedOrder, config.Renames), keys))
+	}
+
+	// nearly sorted files are not worth the churn
+	return config.DisorderThreshold <= 0 || disorder(unsorted, f.tree.Decls) > config.DisorderThreshold, nil
+}
+
+// output writes the declarations in their current order to w, with the
+// barrier comments back in place
+func (f *prepared) output(w io.Writer, config Config) error {
+	attachBarriers(f.tree, f.comments, f.barriers)
+	return output(w, f.fset, f.tree, f.contents, f.comments, config)
+}
+
+// rewrite changes the contents of declarations, e.g. by sorting the specs
+// of a block
+func rewrite(contents []byte, config Config) ([]byte, error) {
+	var err error
+	if config.NormalizeImports {
+		contents, err = normalizeImports(contents)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.SortImports || config.MergeImportGroups || config.GroupImports || config.LocalImportPrefix != "" {
+		contents, err = sortImports(contents, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.BlankImportsLast {
+		contents, err = blankImportsLast(contents)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.NormalizeBuildTags {
+		contents, err = normalizeBuildTags(contents)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.SortStructFields || config.SortInterfaceMethods {
+		contents, err = sortMembers(contents, config.SortStructFields, config.SortInterfaceMethods)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.SortSpecs || config.DocumentedSpecsFirst {
+		contents, err = sortSpecs(contents, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return contents, nil
+}
+
+func parseFile(contents []byte) (*token.FileSet, *ast.File, map[ast.Decl][]byte, error) {
+	fset := token.NewFileSet()
+	tree, err := parser.ParseFile(
+		fset,
+		"", contents,
+		parser.ParseComments|parser.AllErrors,
+	)
+
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed paring file to AST: %w", err)
+	}
+
+	return fset, tree, assignRootCommentsToDecl(fset, tree, contents), nil
+}
+
+// output writes the sorted file, formatted with gofmt if enabled
+func output(w io.Writer, fset *token.FileSet, tree *ast.File, contents []byte, comments map[ast.Decl][]byte, config Config) error {
+	text := func(d ast.Decl) []byte {
+		return contents[d.Pos()-1 : d.End()-1]
+	}
+	if config.UsePrinter {
+		text = func(d ast.Decl) []byte {
+			return printDecl(fset, tree, d)
+		}
+	}
+	var spacing func(a, b ast.Decl) int
+	if config.PreserveSpacing {
+		spacing = sourceSpacing(fset, tree)
+	}
+
+	if config.Gofmt {
+		var buf bytes.Buffer
+		write(&buf, tree, text, comments, spacing, config)
+
+		out, err := format.Source(buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to gofmt output: %w", err)
+		}
+
+		_, err = w.Write(out)
+		return err
+	}
+
+	write(w, tree, text, comments, spacing, config)
+
+	return nil
+}
+
+func write(w io.Writer, tree *ast.File, text func(ast.Decl) []byte, comments map[ast.Decl][]byte, spacing func(a, b ast.Decl) int, config Config) {
+	// everything above the package clause is kept verbatim, dropping
+	// build constraints would change what the file is built for
+	if preamble, ok := comments[filePreamble]; ok {
+		w.Write(preamble)
+	}
+
+	fmt.Fprintf(w, "package %s\n", tree.Name)
+	if len(tree.Decls) > 0 || len(comments[fileHeader]) > 0 || len(comments[nil]) > 0 {
+		w.Write([]byte("\n"))
+	}
+
+	if comments, ok := comments[fileHeader]; ok {
+		w.Write(comments)
+	}
+
+	for i, decl := range tree.Decls {
+		// trailing comments
+		if comments, ok := comments[decl]; ok {
+			w.Write(comments)
+		}
+
+		// declaration itself
+		w.Write(text(decl))
+		if comment, ok := comments[lineComment{decl}]; ok {
+			w.Write(comment)
+		}
+
+		// leading new lines
+		if i < len(tree.Decls)-1 {
+			next := tree.Decls[i+1]
+			blank := 1
+			if spacing != nil {
+				blank = spacing(decl, next)
+			}
+			if startsReceiver(decl, next, config) && config.BlankLinesBetweenReceivers > blank {
+				blank = config.BlankLinesBetweenReceivers
+			}
+			w.Write(bytes.Repeat([]byte("\n"), blank+1))
+		}
+	}
+
+	if comments, ok := comments[nil]; ok {
+		w.Write(comments)
+	}
+}
@@ -0,0 +1,847 @@
+package order
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+//go:embed testdata
+var testdata embed.FS
+
+func TestSortAST(t *testing.T) {
+	dirs, err := testdata.ReadDir("testdata")
+	require.NoError(t, err)
+
+	var paths []string
+	for _, entry := range dirs {
+		require.True(t, entry.IsDir())
+		p := path.Join("testdata", entry.Name())
+		// directories without an in.txt hold fixtures for other tests
+		if _, err := fs.Stat(testdata, path.Join(p, "in.txt")); err != nil {
+			continue
+		}
+		paths = append(paths, p)
+	}
+
+	for _, p := range paths {
+		t.Run(p, func(t *testing.T) {
+			config := Config{
+				SortAlphabetically: true,
+			}
+
+			// optional per-test overrides
+			if b, err := os.ReadFile(path.Join(p, "config.json")); err == nil {
+				require.NoError(t, json.Unmarshal(b, &config))
+			}
+
+			in, err := os.ReadFile(path.Join(p, "in.txt"))
+			require.NoError(t, err)
+
+			actual := &bytes.Buffer{}
+			err = OrderTo(actual, in, config)
+
+			// expected failure
+			if expected, rerr := os.ReadFile(path.Join(p, "error.txt")); rerr == nil {
+				require.EqualError(t, err, strings.TrimSuffix(string(expected), "\n"))
+				return
+			}
+			require.NoError(t, err)
+
+			expected, err := os.ReadFile(path.Join(p, "expected.txt"))
+			require.NoError(t, err)
+
+			require.Equal(t, string(expected), actual.String())
+
+			// sorting again changes nothing
+			again := &bytes.Buffer{}
+			require.NoError(t, OrderTo(again, actual.Bytes(), config))
+			require.Equal(t, actual.String(), again.String(), "not idempotent")
+		})
+	}
+}
+
+func FuzzOrder(f *testing.F) {
+	dirs, err := testdata.ReadDir("testdata")
+	require.NoError(f, err)
+	for _, entry := range dirs {
+		if in, err := testdata.ReadFile(path.Join("testdata", entry.Name(), "in.txt")); err == nil {
+			f.Add(in)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		config := Config{SortAlphabetically: true}
+		once, err := Order(in, config)
+		if err != nil {
+			return
+		}
+		twice, err := Order(once, config)
+		require.NoError(t, err, "sorted output does not parse:\n%s", once)
+		require.Equal(t, string(once), string(twice), "not idempotent")
+	})
+}
+
+func TestOrder(t *testing.T) {
+	in := []byte("package main\n\nfunc b() {}\n\nfunc a() {}\n")
+
+	out, err := Order(in, Config{SortAlphabetically: true})
+	require.NoError(t, err)
+	require.Equal(t, "package main\n\nfunc a() {}\n\nfunc b() {}\n", string(out))
+
+	_, err = Order([]byte("package main\n\nfunc {"), Config{})
+	require.Error(t, err)
+
+	_, err = Order(in, Config{PriorityMethodPattern: "Handle("})
+	require.EqualError(t, err, "failed to sort AST: invalid priority method pattern: error parsing regexp: missing closing ): `Handle(`")
+}
+
+func TestParseOrder(t *testing.T) {
+	kinds, err := ParseOrder("import, type,const,var,func")
+	require.NoError(t, err)
+	require.Equal(t, map[token.Token]int{token.IMPORT: 0, token.TYPE: 1, token.CONST: 2, token.VAR: 3, token.FUNC: 4}, kinds)
+
+	out, err := Order([]byte("package main\n\nimport \"fmt\"\n\nconst c = 1\n\nfunc f() { fmt.Println() }\n\ntype T int\n"), Config{Order: kinds})
+	require.NoError(t, err)
+	require.Equal(t, "package main\n\nimport \"fmt\"\n\ntype T int\n\nconst c = 1\n\nfunc f() { fmt.Println() }\n", string(out))
+
+	for s, msg := range map[string]string{
+		"import,type,const,var,method": `unknown declaration kind "method": must be one of import, const, var, type or func`,
+		"import,type,const,var,var":    `declaration kind "var" is listed twice`,
+		"import,type,const,var":        `declaration kind "func" is missing`,
+		"type,import,const,var,func":   "imports must come first",
+	} {
+		_, err := ParseOrder(s)
+		require.EqualError(t, err, msg, s)
+	}
+}
+
+func TestSortKey(t *testing.T) {
+	require.Negative(t, compareNatural("v2", "v10"))
+	require.Negative(t, compareNatural("v2a", "v2b"))
+	require.Zero(t, compareNatural("v02", "v2"))
+	require.Zero(t, compareFolded("Ärger", "ärger"))
+	require.Negative(t, compareFolded("apple", "Banana"))
+	require.Negative(t, compareExported("Zeta", "alpha"))
+
+	_, err := Order([]byte("package main\n"), Config{SortKey: []string{"natural", "length"}})
+	require.EqualError(t, err, `failed to sort AST: unknown sort key "length": must be natural, case-insensitive or export`)
+}
+
+func TestUsePrinter(t *testing.T) {
+	for _, p := range []string{"testdata/structs", "testdata/test01", "testdata/mirror_embedded", "testdata/k8s_markers", "testdata/generic_types", "testdata/example_output", "testdata/line_comments"} {
+		t.Run(p, func(t *testing.T) {
+			config := Config{SortAlphabetically: true}
+			if b, err := os.ReadFile(path.Join(p, "config.json")); err == nil {
+				require.NoError(t, json.Unmarshal(b, &config))
+			}
+			in, err := os.ReadFile(path.Join(p, "in.txt"))
+			require.NoError(t, err)
+
+			sliced := &bytes.Buffer{}
+			require.NoError(t, OrderTo(sliced, in, config))
+			expected, err := format.Source(sliced.Bytes())
+			require.NoError(t, err)
+
+			config.UsePrinter = true
+			printed := &bytes.Buffer{}
+			require.NoError(t, OrderTo(printed, in, config))
+
+			// only the spacing within declarations may differ
+			require.Equal(t, string(expected), printed.String())
+		})
+	}
+}
+
+func TestBlankMethod(t *testing.T) {
+	in := `package main
+
+func (_ Foo) _() {}
+
+func (f Foo) b() {}
+
+func (Foo) A() {}
+
+func (f *Foo) _() {}
+
+type Foo struct{}
+`
+	expected := `package main
+
+type Foo struct{}
+
+func (Foo) A() {}
+
+func (f Foo) b() {}
+
+func (_ Foo) _() {}
+
+func (f *Foo) _() {}
+`
+
+	_, tree, _, err := parseFile([]byte(in))
+	require.NoError(t, err)
+	require.Equal(t, funcOrMethod{recv: "Foo", name: "_"}, funcName(tree.Decls[0].(*ast.FuncDecl)))
+
+	actual := &bytes.Buffer{}
+	require.NoError(t, OrderTo(actual, []byte(in), Config{SortAlphabetically: true}))
+	require.Equal(t, expected, actual.String())
+}
+
+func TestDisorderThreshold(t *testing.T) {
+	// b and a swapped: 2 of 4 declarations are out of their slot
+	in := "package main\n\nfunc b() {}\n\nfunc a() {}\n\nfunc c() {}\n\nfunc d() {}\n"
+	sorted := "package main\n\nfunc a() {}\n\nfunc b() {}\n\nfunc c() {}\n\nfunc d() {}\n"
+
+	for threshold, expected := range map[float64]string{
+		0:    sorted,
+		0.49: sorted,
+		0.5:  in,
+		1:    in,
+	} {
+		out := &bytes.Buffer{}
+		require.NoError(t, OrderTo(out, []byte(in), Config{SortAlphabetically: true, DisorderThreshold: threshold}))
+		require.Equal(t, expected, out.String(), "threshold %v", threshold)
+	}
+}
+
+func TestIsIgnored(t *testing.T) {
+	for constraint, ignored := range map[string]bool{
+		"//go:build ignore":                        true,
+		"//go:build ignore && linux":               true,
+		"//go:build (ignore || tools) && !tools":   true,
+		"// +build ignore":                         true,
+		"//go:build (linux && amd64) || darwin":    false,
+		"//go:build !linux":                        false,
+		"//go:build !ignore":                       false,
+		"//go:build ignore || linux":               false,
+		"//go:build (linux && !ignore) || windows": false,
+	} {
+		_, tree, _, err := parseFile([]byte(constraint + "\n\npackage main\n"))
+		require.NoError(t, err)
+		require.Equal(t, ignored, isIgnored(tree), constraint)
+	}
+}
+
+func TestIsGenerated(t *testing.T) {
+	for header, generated := range map[string]bool{
+		"// Code generated by protoc-gen-go. DO NOT EDIT.":                true,
+		"// Copyright 2023\n\n// Code generated by mockery. DO NOT EDIT.": true,
+		"// Code generated by hand. DO NOT EDIT":                          false,
+		"// Code generated DO NOT EDIT.":                                  false,
+		"/* Code generated by x. DO NOT EDIT. */":                         false,
+		"// code generated by x. DO NOT EDIT.":                            false,
+	} {
+		_, tree, _, err := parseFile([]byte(header + "\n\npackage main\n"))
+		require.NoError(t, err)
+		require.Equal(t, generated, isGenerated(tree), header)
+	}
+
+	// the marker only counts above the package clause
+	_, tree, _, err := parseFile([]byte("package main\n\n// Code generated by x. DO NOT EDIT.\nfunc f() {}\n"))
+	require.NoError(t, err)
+	require.False(t, isGenerated(tree))
+}
+
+func TestHasIgnoreDirective(t *testing.T) {
+	for src, ignored := range map[string]bool{
+		"// go-order:ignore\n\npackage main\n":                    true,
+		"package main\n\n//go-order:ignore\n\nfunc f() {}\n":      true,
+		"package main\n\n// go-order:ignore ordered on purpose\n": true,
+		"package main\n\n//order:ignore\n":                        false,
+		"package main\n\n//go-order:ignored\n":                    false,
+		"package main\n\nfunc f() {}\n\n// go-order:ignore\n":     false,
+		"package main\n\nfunc f() {\n\t// go-order:ignore\n}\n":   false,
+	} {
+		_, tree, _, err := parseFile([]byte(src))
+		require.NoError(t, err)
+		require.Equal(t, ignored, hasIgnoreDirective(tree), src)
+	}
+}
+
+func TestRenames(t *testing.T) {
+	renames, err := ParseRenames(strings.NewReader("# renamed in v2\nServer serverImpl\n\nhandleUsers handleAccounts\nServer.Run Server.Serve\n"))
+	require.NoError(t, err)
+
+	for key, renamed := range map[string]string{
+		"type Server":            "type serverImpl",
+		"func Server.Close":      "func serverImpl.Close",
+		"func Server.Run":        "func Server.Serve",
+		"func handleUsers":       "func handleAccounts",
+		"var (handleUsers, x)":   "var (handleAccounts, x)",
+		"func handleUsers #2":    "func handleAccounts #2",
+		`import "handleUsers"`:   `import "handleUsers"`,
+		"func handleUsersByName": "func handleUsersByName",
+	} {
+		require.Equal(t, renamed, renameKey(key, renames), key)
+	}
+
+	_, err = ParseRenames(strings.NewReader("a b\nc\n"))
+	require.EqualError(t, err, `line 2: want an old and a new name, got "c"`)
+	_, err = ParseRenames(strings.NewReader("a b\na c\n"))
+	require.EqualError(t, err, "line 2: a is renamed twice")
+}
+
+func TestNormalizeBuildTags(t *testing.T) {
+	in, err := os.ReadFile("testdata/normalize_build_tags/tags.txt")
+	require.NoError(t, err)
+	expected, err := os.ReadFile("testdata/normalize_build_tags/expected.txt")
+	require.NoError(t, err)
+
+	out, err := normalizeBuildTags(in)
+	require.NoError(t, err)
+	require.Equal(t, string(expected), string(out))
+
+	// a lone +build line is sorted on its own
+	out, err = normalizeBuildTags([]byte("// +build linux,amd64 darwin\n\npackage main\n"))
+	require.NoError(t, err)
+	require.Equal(t, "// +build amd64,linux darwin\n\npackage main\n", string(out))
+}
+
+func TestScript(t *testing.T) {
+	in := []byte(`package main
+
+func (f Foo) String() string { return "" }
+
+func zzz() {}
+
+type Foo struct{}
+
+func aaa() {}
+
+const c = 1
+`)
+	config := Config{SortAlphabetically: true}
+
+	moves, err := Script(in, config)
+	require.NoError(t, err)
+
+	script := &bytes.Buffer{}
+	require.NoError(t, WriteScript(script, moves))
+	require.Equal(t, `move const c first
+move type Foo after const c
+move func aaa after func Foo.String
+`, script.String())
+
+	// reading the script back and applying it sorts the file
+	parsed, err := ParseScript(strings.NewReader("# reviewed\n\n" + script.String()))
+	require.NoError(t, err)
+	require.Equal(t, moves, parsed)
+
+	applied := &bytes.Buffer{}
+	require.NoError(t, ApplyScript(applied, in, parsed, config))
+	sorted, err := Order(in, config)
+	require.NoError(t, err)
+	require.Equal(t, string(sorted), applied.String())
+
+	// edited scripts apply exactly the moves they list
+	edited := &bytes.Buffer{}
+	require.NoError(t, ApplyScript(edited, in, []Move{{Key: "func aaa"}}, config))
+	require.Equal(t, "package main\n\nfunc aaa() {}\n\nfunc (f Foo) String() string { return \"\" }\n\nfunc zzz() {}\n\ntype Foo struct{}\n\nconst c = 1\n", edited.String())
+
+	require.EqualError(t, ApplyScript(&bytes.Buffer{}, in, []Move{{Key: "func nope"}}, config), "move func nope first: unknown declaration func nope")
+	_, err = ParseScript(strings.NewReader("swap a b"))
+	require.EqualError(t, err, `line 1: expected "move": swap a b`)
+
+	// scripts go through the same rewriting as OrderTo
+	specs := []byte("package main\n\nfunc b() {}\n\nconst (\n\tz = 1\n\ta = 2\n)\n")
+	specsConfig := Config{SortAlphabetically: true, SortSpecs: true}
+	moves, err = Script(specs, specsConfig)
+	require.NoError(t, err)
+	require.Equal(t, []Move{{Key: "const (a, z)"}}, moves)
+	applied.Reset()
+	require.NoError(t, ApplyScript(applied, specs, moves, specsConfig))
+	sorted, err = Order(specs, specsConfig)
+	require.NoError(t, err)
+	require.Equal(t, string(sorted), applied.String())
+
+	// and leave the same files alone
+	generated := append([]byte("// Code generated by hand. DO NOT EDIT.\n\n"), in...)
+	moves, err = Script(generated, config)
+	require.NoError(t, err)
+	require.Empty(t, moves)
+	applied.Reset()
+	require.NoError(t, ApplyScript(applied, generated, []Move{{Key: "func aaa"}}, config))
+	require.Equal(t, string(generated), applied.String())
+}
+
+func TestSortPatch(t *testing.T) {
+	in := `package main
+
+func zzz() {}
+
+func bbb() {}
+
+func aaa() {}
+`
+	patch := `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -4,2 +4,4 @@ func zzz() {}
+ 
+ func bbb() {}
++
++func aaa() {}
+`
+	expected := `package main
+
+func aaa() {}
+
+func zzz() {}
+
+func bbb() {}
+`
+
+	lines, err := ParsePatch(strings.NewReader(patch), "main.go")
+	require.NoError(t, err)
+	require.Equal(t, []LineRange{{Start: 6, End: 7}}, lines)
+
+	actual := &bytes.Buffer{}
+	err = OrderTo(actual, []byte(in), Config{SortAlphabetically: true, OnlyLines: lines})
+	require.NoError(t, err)
+	require.Equal(t, expected, actual.String())
+
+	// touched declarations stay below //order:start, out of off regions and
+	// between their barriers
+	in = `package main
+
+func zzz() {}
+
+//order:start
+
+func yyy() {}
+
+// go-order:off
+
+func ccc() {}
+
+// go-order:on
+
+func bbb() {}
+
+func aaa() {}
+`
+	expected = `package main
+
+func zzz() {}
+
+//order:start
+
+func yyy() {}
+
+// go-order:off
+
+func ccc() {}
+
+// go-order:on
+
+func aaa() {}
+
+func bbb() {}
+`
+	actual.Reset()
+	err = OrderTo(actual, []byte(in), Config{SortAlphabetically: true, OnlyLines: []LineRange{{Start: 1, End: 19}}})
+	require.NoError(t, err)
+	require.Equal(t, expected, actual.String())
+}
+
+func TestParsePatchHunkLines(t *testing.T) {
+	// removed and added lines starting like file headers belong to the hunk
+	patch := `--- a/schema.go
++++ b/schema.go
+@@ -3,3 +3,3 @@ package schema
+ const create = ` + "`" + `
+--- the users table
+++++ the accounts table
+ CREATE TABLE users (id int)
+@@ -10,1 +10,2 @@ func drop() {}
+ var x = 1
++var y = 2
+--- a/other.go
++++ b/other.go
+@@ -1,1 +1,2 @@
+ package other
++var z = 3
+`
+	lines, err := ParsePatch(strings.NewReader(patch), "schema.go")
+	require.NoError(t, err)
+	require.Equal(t, []LineRange{{Start: 4, End: 4}, {Start: 11, End: 11}}, lines)
+}
+
+func TestAlignVariants(t *testing.T) {
+	dir := "testdata/align_variants"
+	read := func(name string) []byte {
+		b, err := os.ReadFile(path.Join(dir, name))
+		require.NoError(t, err)
+		return b
+	}
+
+	// bar_windows.txt declares Lock, which sorts before the shared Remove
+	for _, name := range []string{"foo", "bar"} {
+		t.Run(name, func(t *testing.T) {
+			a, b, err := AlignVariants(read(name+".txt"), read(name+"_windows.txt"), Config{})
+			require.NoError(t, err)
+
+			require.Equal(t, string(read(name+".expected.txt")), string(a))
+			require.Equal(t, string(read(name+"_windows.expected.txt")), string(b))
+		})
+	}
+}
+
+func TestAuditTodos(t *testing.T) {
+	in := `package main
+
+// FIXME: racy
+var counter int
+
+func zzz() {
+	// TODO: handle errors
+}
+
+// TODO(dom): remove once migrated
+type Legacy struct{}
+
+func aaa() {}
+
+// TODO: trailing
+`
+
+	todos, err := AuditTodos([]byte(in), Config{SortAlphabetically: true})
+	require.NoError(t, err)
+	require.Equal(t, []Todo{
+		{Line: 3, Text: "FIXME: racy", Decl: "var counter"},
+		{Line: 10, Text: "TODO(dom): remove once migrated", Decl: "type Legacy"},
+		{Line: 7, Text: "TODO: handle errors", Decl: "func zzz"},
+		{Line: 15, Text: "TODO: trailing"},
+	}, todos)
+
+	out := &bytes.Buffer{}
+	WriteAudit(out, "main.go", todos[:1])
+	require.Equal(t, "main.go:3: FIXME: racy (var counter)\n", out.String())
+}
+
+func TestComplexity(t *testing.T) {
+	in := `package main
+
+func zzz(xs []int) int {
+	sum := 0
+	for _, x := range xs {
+		if x > 0 && x < 10 || x == 42 {
+			sum += x
+		}
+	}
+	return sum
+}
+
+func (f Foo) String() string { return "" }
+
+func aaa(c chan int, n int) {
+	switch n {
+	case 1, 2:
+	case 3:
+	default:
+	}
+	select {
+	case <-c:
+	default:
+	}
+	go func() {
+		for {
+		}
+	}()
+}
+
+type Foo struct{}
+`
+
+	result, err := Complexity([]byte(in), Config{SortAlphabetically: true})
+	require.NoError(t, err)
+	require.Equal(t, []DeclComplexity{
+		{Decl: "func Foo.String", Line: 13, Complexity: 1},
+		{Decl: "func aaa", Line: 15, Complexity: 5},
+		{Decl: "func zzz", Line: 3, Complexity: 5},
+	}, result)
+
+	out := &bytes.Buffer{}
+	WriteComplexity(out, "", result[2:])
+	require.Equal(t, "<stdin>:3: 5 func zzz\n", out.String())
+}
+
+func TestShadows(t *testing.T) {
+	in, err := os.ReadFile("testdata/shadows/shadows.txt")
+	require.NoError(t, err)
+	expected, err := os.ReadFile("testdata/shadows/warnings.txt")
+	require.NoError(t, err)
+
+	shadows, err := Shadows(in)
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	WriteShadows(out, "shadows.go", shadows)
+	require.Equal(t, string(expected), out.String())
+}
+
+func TestCommentPlacements(t *testing.T) {
+	in, err := os.ReadFile("testdata/comment_placements/comments.txt")
+	require.NoError(t, err)
+	expected, err := os.ReadFile("testdata/comment_placements/report.txt")
+	require.NoError(t, err)
+
+	placements, err := CommentPlacements(in, Config{})
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	WriteCommentPlacements(out, "main.go", placements)
+	require.Equal(t, string(expected), out.String())
+
+	// sticky comments move with the declaration below
+	placements, err = CommentPlacements(in, Config{StickyCommentPrefixes: []string{"//nolint"}})
+	require.NoError(t, err)
+	require.Equal(t, "attached to func zzz", placements[1].Placement)
+}
+
+func TestParseTaxonomy(t *testing.T) {
+	categories, err := ParseTaxonomy(strings.NewReader(`
+categories:
+  - name: handlers
+    patterns: ["^handle"]
+  - name: helpers
+    patterns: ["."]
+`))
+	require.NoError(t, err)
+	require.Equal(t, []Category{
+		{Name: "handlers", Patterns: []string{"^handle"}},
+		{Name: "helpers", Patterns: []string{"."}},
+	}, categories)
+
+	for name, in := range map[string]string{
+		"empty":         `categories: []`,
+		"no name":       `categories: [{patterns: ["."]}]`,
+		"duplicate":     `categories: [{name: a, patterns: ["."]}, {name: a, patterns: ["."]}]`,
+		"no patterns":   `categories: [{name: a}]`,
+		"bad pattern":   `categories: [{name: a, patterns: ["("]}]`,
+		"unknown field": `categories: [{name: a, pattern: "."}]`,
+	} {
+		_, err := ParseTaxonomy(strings.NewReader(in))
+		require.Error(t, err, name)
+	}
+}
+
+func TestHTMLReport(t *testing.T) {
+	in := `package main
+
+func b() {}
+
+func a() {}
+
+func c() {}
+`
+
+	out := &bytes.Buffer{}
+	err := HTMLReport(out, "main.go", []byte(in), Config{SortAlphabetically: true})
+	require.NoError(t, err)
+
+	html := out.String()
+	require.Contains(t, html, "<th>Before</th><th>After</th>")
+	// before: b, a, c; after: a, b, c. Only a moved.
+	require.Equal(t, 2, strings.Count(html, `<pre class="moved">func a() {}</pre>`))
+	require.Equal(t, 2, strings.Count(html, `<pre>func b() {}</pre>`))
+	require.Less(t, strings.Index(html, "func b()"), strings.Index(html, "func a()"))
+	require.Less(t, strings.LastIndex(html, "func a()"), strings.LastIndex(html, "func b()"))
+}
+
+func TestVerifyDecls(t *testing.T) {
+	in := []byte(`package main
+
+func b() string {
+	return "b"
+}
+
+func a() string {
+	return "a"
+}
+`)
+
+	sorted := &bytes.Buffer{}
+	require.NoError(t, OrderTo(sorted, in, Config{SortAlphabetically: true}))
+	require.NoError(t, VerifyDecls(in, sorted.Bytes(), Config{}))
+
+	// slicing one byte short cuts the closing quote of the last statement
+	offByOne := []byte(`package main
+
+func a() string {
+	return "a"
+}
+
+func b() string {
+	return "b
+}
+`)
+	require.Error(t, VerifyDecls(in, offByOne, Config{}))
+
+	changed := bytes.Replace(sorted.Bytes(), []byte(`"a"`), []byte(`"A"`), 1)
+	require.EqualError(t, VerifyDecls(in, changed, Config{}), "content of declaration func a changed while sorting")
+
+	dropped := []byte("package main\n\nfunc a() string {\n\treturn \"a\"\n}\n")
+	require.EqualError(t, VerifyDecls(in, dropped, Config{}), "declaration func b is missing from the sorted output")
+
+	// specs and imports rewritten on purpose are not reported
+	rewritten := []byte("package main\n\nimport (\n\t\"os\"\n\t\"fmt\"\n)\n\nconst (\n\tb = 1\n\ta = 2\n)\n\nfunc f() { fmt.Println(os.Args) }\n")
+	config := Config{SortAlphabetically: true, SortSpecs: true, SortImports: true}
+	sorted.Reset()
+	require.NoError(t, OrderTo(sorted, rewritten, config))
+	require.NoError(t, VerifyDecls(rewritten, sorted.Bytes(), config))
+}
+
+func TestAssertAPIStable(t *testing.T) {
+	in := []byte(`package main
+
+// B is exported
+func B(s string) string {
+	return s
+}
+
+func (f Foo) String() string {
+	return "foo"
+}
+
+type Foo struct {
+	Name string // the name
+}
+
+func a() {}
+`)
+
+	sorted := &bytes.Buffer{}
+	require.NoError(t, OrderTo(sorted, in, Config{SortAlphabetically: true}))
+	require.NoError(t, AssertAPIStable(in, sorted.Bytes()))
+
+	dropped := bytes.Replace(sorted.Bytes(), []byte("func B(s string) string {\n\treturn s\n}\n"), nil, 1)
+	require.EqualError(t, AssertAPIStable(in, dropped), "exported func B is missing from the sorted output")
+
+	changed := bytes.Replace(sorted.Bytes(), []byte("B(s string)"), []byte("B(s []byte)"), 1)
+	require.EqualError(t, AssertAPIStable(in, changed), "signature of exported func B changed while sorting")
+
+	added := append(sorted.Bytes(), []byte("\nfunc C() {}\n")...)
+	require.EqualError(t, AssertAPIStable(in, added), "exported func C appeared while sorting")
+}
+
+func TestGithubSuggestions(t *testing.T) {
+	in := `package main
+
+import "fmt"
+
+func b() {}
+
+func a() {}
+
+const c = 1
+`
+
+	found, err := Suggestions([]byte(in), Config{SortAlphabetically: true})
+	require.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	WriteSuggestions(out, "main.go", found)
+	// func a() stays on line 7, so b and c make two separate regions
+	require.Equal(t, "main.go:5-5\n"+
+		"```suggestion\n"+
+		"const c = 1\n"+
+		"```\n"+
+		"main.go:9-9\n"+
+		"```suggestion\n"+
+		"func b() {}\n"+
+		"```\n", out.String())
+
+	sorted, err := Suggestions([]byte("package main\n\nfunc a() {}\n"), Config{SortAlphabetically: true})
+	require.NoError(t, err)
+	require.Empty(t, sorted)
+}
+
+func TestReportPairings(t *testing.T) {
+	read := func(name string) []byte {
+		b, err := os.ReadFile(path.Join("testdata/pairings", name))
+		require.NoError(t, err)
+		return b
+	}
+
+	pairings, err := PairTests(read("foo.txt"), read("foo_test.txt"))
+	require.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	require.NoError(t, WritePairings(out, pairings))
+	require.Equal(t, string(read("pairings.json")), out.String())
+}
+
+func TestConfigSchema(t *testing.T) {
+	out := &bytes.Buffer{}
+	require.NoError(t, ConfigSchema(out))
+
+	var schema struct {
+		Type       string
+		Properties map[string]struct {
+			Type        any
+			Description string
+		}
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &schema))
+	require.Equal(t, "object", schema.Type)
+
+	fields := reflect.VisibleFields(reflect.TypeOf(Config{}))
+	require.Len(t, schema.Properties, len(fields))
+	for _, field := range fields {
+		property, ok := schema.Properties[field.Name]
+		require.True(t, ok, "%s is missing", field.Name)
+		require.NotEmpty(t, property.Type, field.Name)
+		require.NotEmpty(t, property.Description, field.Name)
+	}
+}
+
+func TestDeclFingerprints(t *testing.T) {
+	a, err := DeclFingerprints([]byte(`package a
+
+func Max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func Min(a, b int) int {
+	return a
+}
+`))
+	require.NoError(t, err)
+
+	b, err := DeclFingerprints([]byte(`package b
+
+type T struct{}
+
+func Min(a, b int) int {
+	return b
+}
+
+func Max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+`))
+	require.NoError(t, err)
+
+	require.Len(t, a, 2)
+	require.Len(t, b, 3)
+	require.Len(t, a["func Max"], 64)
+	require.Equal(t, a["func Max"], b["func Max"])
+	require.NotEqual(t, a["func Min"], b["func Min"])
+}
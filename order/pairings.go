@@ -0,0 +1,83 @@
+package order
+
+import (
+	"encoding/json"
+	"go/ast"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Pairing links a test function to the declaration it tests, Decl is empty
+// if none was found
+type Pairing struct {
+	Test string `json:"test"`
+	Decl string `json:"decl,omitempty"`
+}
+
+// PairTests matches the Test functions of tests with the declarations of src
+// by name: TestFoo pairs with Foo or foo and TestFoo_Bar with the method Bar
+// of Foo
+func PairTests(src, tests []byte) ([]Pairing, error) {
+	_, tree, _, err := parseFile(src)
+	if err != nil {
+		return nil, err
+	}
+	_, testTree, _, err := parseFile(tests)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]string{}
+	for _, d := range tree.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			keys[funcName(d).String()] = declKey(d)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if spec, ok := spec.(*ast.TypeSpec); ok {
+					keys[spec.Name.Name] = "type " + spec.Name.Name
+				}
+			}
+		}
+	}
+
+	pairings := []Pairing{}
+	for _, d := range testTree.Decls {
+		f, ok := d.(*ast.FuncDecl)
+		if !ok || f.Recv != nil || !strings.HasPrefix(f.Name.Name, "Test") || f.Name.Name == "TestMain" {
+			continue
+		}
+
+		name := strings.TrimPrefix(strings.TrimPrefix(f.Name.Name, "Test"), "_")
+		var candidates []string
+		if recv, method, ok := strings.Cut(name, "_"); ok {
+			candidates = append(candidates, recv+"."+method, lowerFirst(recv)+"."+method, recv, lowerFirst(recv))
+		} else {
+			candidates = append(candidates, name, lowerFirst(name))
+		}
+
+		p := Pairing{Test: f.Name.Name}
+		for _, c := range candidates {
+			if key, ok := keys[c]; ok {
+				p.Decl = key
+				break
+			}
+		}
+		pairings = append(pairings, p)
+	}
+	return pairings, nil
+}
+
+func lowerFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[size:]
+}
+
+// WritePairings writes the pairings as indented JSON
+func WritePairings(w io.Writer, pairings []Pairing) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(pairings)
+}
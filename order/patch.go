@@ -0,0 +1,186 @@
+package order
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LineRange is an inclusive range of line numbers, starting at 1
+type LineRange struct {
+	Start, End int
+}
+
+// ParsePatch returns the lines of fname that were added or changed by the
+// unified diff read from r. If fname is empty, hunks of all files are used.
+func ParsePatch(r io.Reader, fname string) ([]LineRange, error) {
+	var (
+		ranges = []LineRange{}
+		match  = fname == ""
+		line   int
+		// lines of the current hunk left to read on either side, headers
+		// only come after them
+		oldLeft, newLeft int
+	)
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		text := sc.Text()
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(text, "+"):
+				if match {
+					ranges = appendLine(ranges, line)
+				}
+				line++
+				newLeft--
+			case strings.HasPrefix(text, "-"):
+				// a deletion touches the line that now takes its place
+				if match {
+					ranges = appendLine(ranges, line)
+				}
+				oldLeft--
+			case strings.HasPrefix(text, " ") || text == "":
+				line++
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(text, "+++ "):
+			if fname == "" {
+				continue
+			}
+			name := strings.TrimPrefix(text, "+++ ")
+			// strip the timestamp some tools append
+			if i := strings.IndexByte(name, '\t'); i >= 0 {
+				name = name[:i]
+			}
+			match = samePath(name, fname)
+		case strings.HasPrefix(text, "@@ "):
+			var oldStart, newStart int
+			if _, err := fmt.Sscanf(hunkHeader(text), "-%d,%d +%d,%d", &oldStart, &oldLeft, &newStart, &newLeft); err != nil {
+				return nil, fmt.Errorf("invalid hunk header %q: %w", text, err)
+			}
+			line = newStart
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read patch: %w", err)
+	}
+
+	return ranges, nil
+}
+
+// hunkHeader normalizes "@@ -a +b @@" into "-a,1 +b,1"
+func hunkHeader(text string) string {
+	fields := strings.Fields(text)
+	if len(fields) < 3 {
+		return text
+	}
+	old, new := fields[1], fields[2]
+	if !strings.Contains(old, ",") {
+		old += ",1"
+	}
+	if !strings.Contains(new, ",") {
+		new += ",1"
+	}
+	return old + " " + new
+}
+
+func appendLine(ranges []LineRange, line int) []LineRange {
+	if n := len(ranges); n > 0 && ranges[n-1].End >= line-1 {
+		if line > ranges[n-1].End {
+			ranges[n-1].End = line
+		}
+		return ranges
+	}
+	return append(ranges, LineRange{Start: line, End: line})
+}
+
+// samePath reports whether the path in a diff header refers to fname,
+// ignoring the a/ and b/ prefixes used by git
+func samePath(header, fname string) bool {
+	header = filepath.ToSlash(filepath.Clean(header))
+	fname = filepath.ToSlash(filepath.Clean(fname))
+	if strings.HasPrefix(header, "a/") || strings.HasPrefix(header, "b/") {
+		header = header[2:]
+	}
+	return header == fname ||
+		strings.HasSuffix(header, "/"+fname) ||
+		strings.HasSuffix(fname, "/"+header)
+}
+
+// touches reports whether the declaration, including its doc comment,
+// overlaps any of the ranges
+func touches(fset *token.FileSet, d ast.Decl, ranges []LineRange) bool {
+	pos := d.Pos()
+	switch d := d.(type) {
+	case *ast.FuncDecl:
+		if d.Doc != nil {
+			pos = d.Doc.Pos()
+		}
+	case *ast.GenDecl:
+		if d.Doc != nil {
+			pos = d.Doc.Pos()
+		}
+	}
+
+	start, end := fset.Position(pos).Line, fset.Position(d.End()).Line
+	for _, r := range ranges {
+		if r.Start <= end && start <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// sortTouched moves only the declarations touched by ranges. Each one is
+// placed before the first untouched declaration that should come after it,
+// everything else stays where it was.
+func sortTouched(fset *token.FileSet, decls []ast.Decl, s *sorter, ranges []LineRange) {
+	var anchored, moved []ast.Decl
+	for _, d := range decls {
+		if touches(fset, d, ranges) {
+			moved = append(moved, d)
+		} else {
+			anchored = append(anchored, d)
+		}
+	}
+
+	sort.SliceStable(moved, func(i, j int) bool {
+		return s.less(moved[i], moved[j])
+	})
+
+	// insertion point of each moved declaration
+	at := make([]int, len(moved))
+	for i, m := range moved {
+		at[i] = len(anchored)
+		for j, a := range anchored {
+			if s.less(m, a) {
+				at[i] = j
+				break
+			}
+		}
+	}
+
+	result := make([]ast.Decl, 0, len(decls))
+	for j := 0; j <= len(anchored); j++ {
+		for k := range moved {
+			if at[k] == j {
+				result = append(result, moved[k])
+			}
+		}
+		if j < len(anchored) {
+			result = append(result, anchored[j])
+		}
+	}
+	copy(decls, result)
+}
@@ -0,0 +1,95 @@
+package order
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"strings"
+)
+
+// CommentPlacement tells how sorting handles a comment
+type CommentPlacement struct {
+	Line int
+	// Text is the first line of the comment
+	Text string
+	// Placement is one of "attached to <decl>", "inside <decl>",
+	// "pinned at line <n>", "pinned below the package clause",
+	// "above the package clause" or "trailing"
+	Placement string
+}
+
+// CommentPlacements returns how each comment of the file is handled when it
+// is sorted: moved along with a declaration, or pinned in place
+func CommentPlacements(contents []byte, config Config) ([]CommentPlacement, error) {
+	fset, tree, _, err := parseFile(contents)
+	if err != nil {
+		return nil, err
+	}
+	keys := declKeys(tree.Decls)
+	barriers := barrierPositions(fset, tree)
+	lines := lineComments(fset, tree)
+
+	sticky := func(c *ast.CommentGroup) bool {
+		return len(config.StickyCommentPrefixes) > 0 && hasAnyPrefix(c.List[0].Text, config.StickyCommentPrefixes)
+	}
+	placement := func(c *ast.CommentGroup) string {
+		if c.Pos() < tree.Package {
+			return "above the package clause"
+		}
+
+		if d := lines[c]; d != nil {
+			for i := range tree.Decls {
+				if tree.Decls[i] == d {
+					return "at the end of the line of " + keys[i]
+				}
+			}
+		}
+
+		next := -1
+		for i, d := range tree.Decls {
+			if d.Pos() <= c.Pos() && c.End() <= d.End() {
+				return "inside " + keys[i]
+			}
+			if d.Pos() > c.End() {
+				next = i
+				break
+			}
+		}
+
+		// comments up to a barrier stay with it
+		for _, pos := range barriers {
+			if c.Pos() <= pos && (next < 0 || pos < tree.Decls[next].Pos()) {
+				return fmt.Sprintf("pinned at line %d", fset.Position(pos).Line)
+			}
+		}
+
+		switch {
+		case isFileDirective(tree, c) && !sticky(c):
+			return "pinned below the package clause"
+		case next >= 0:
+			return "attached to " + keys[next]
+		default:
+			return "trailing"
+		}
+	}
+
+	result := make([]CommentPlacement, len(tree.Comments))
+	for i, c := range tree.Comments {
+		result[i] = CommentPlacement{
+			Line:      fset.Position(c.Pos()).Line,
+			Text:      strings.SplitN(c.List[0].Text, "\n", 2)[0],
+			Placement: placement(c),
+		}
+	}
+	return result, nil
+}
+
+// WriteCommentPlacements prints the placements, one per line
+func WriteCommentPlacements(w io.Writer, fname string, placements []CommentPlacement) {
+	if fname == "" {
+		fname = "<stdin>"
+	}
+	for _, p := range placements {
+		fmt.Fprintf(w, "%s:%d: %s: %s\n", fname, p.Line, p.Text, p.Placement)
+	}
+}
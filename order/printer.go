@@ -0,0 +1,52 @@
+package order
+
+import (
+	"bytes"
+	"go/ast"
+	"go/printer"
+	"go/token"
+)
+
+// printDecl prints d, along with the comments within it, using the same
+// settings as gofmt. The doc comment is left out since it is written with
+// the other comments above the declaration.
+func printDecl(fset *token.FileSet, tree *ast.File, d ast.Decl) []byte {
+	var inner []*ast.CommentGroup
+	for _, c := range tree.Comments {
+		if d.Pos() <= c.Pos() && c.End() <= d.End() {
+			inner = append(inner, c)
+		}
+	}
+
+	var node ast.Node = d
+	switch d := d.(type) {
+	case *ast.FuncDecl:
+		undocumented := *d
+		undocumented.Doc = nil
+		node = &undocumented
+	case *ast.GenDecl:
+		undocumented := *d
+		undocumented.Doc = nil
+		// the comment at the end of the line is written after the
+		// declaration, see lineComment
+		if !d.Lparen.IsValid() && len(d.Specs) == 1 {
+			switch spec := d.Specs[0].(type) {
+			case *ast.ValueSpec:
+				uncommented := *spec
+				uncommented.Comment = nil
+				undocumented.Specs = []ast.Spec{&uncommented}
+			case *ast.TypeSpec:
+				uncommented := *spec
+				uncommented.Comment = nil
+				undocumented.Specs = []ast.Spec{&uncommented}
+			}
+		}
+		node = &undocumented
+	}
+
+	var buf bytes.Buffer
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	// printing a parsed declaration into a buffer does not fail
+	cfg.Fprint(&buf, fset, &printer.CommentedNode{Node: node, Comments: inner})
+	return buf.Bytes()
+}
@@ -0,0 +1,88 @@
+package order
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseRenames reads a mapping of old declaration names to new ones, one
+// rename per line:
+//
+//	oldName newName
+//	Server.handleUsers Server.handleAccounts
+//
+// Renaming a type renames the receiver of its methods as well. Blank lines
+// and lines starting with # are ignored.
+func ParseRenames(r io.Reader) (map[string]string, error) {
+	renames := map[string]string{}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want an old and a new name, got %q", n, line)
+		}
+		if _, ok := renames[fields[0]]; ok {
+			return nil, fmt.Errorf("line %d: %s is renamed twice", n, fields[0])
+		}
+		renames[fields[0]] = fields[1]
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read renames: %w", err)
+	}
+	return renames, nil
+}
+
+// renameKeys returns keys with the renamed declarations under their new
+// names, so that keys recorded before a rename still match
+func renameKeys(keys []string, renames map[string]string) []string {
+	if len(renames) == 0 {
+		return keys
+	}
+	result := make([]string, len(keys))
+	for i, key := range keys {
+		result[i] = renameKey(key, renames)
+	}
+	return result
+}
+
+// renameKey renames the declarations of a key of declKeys, e.g.
+// "func Foo.String", "var (a, b)" or "func init #2"
+func renameKey(key string, renames map[string]string) string {
+	kind, name, ok := strings.Cut(key, " ")
+	if !ok {
+		return key
+	}
+	var suffix string
+	if i := strings.LastIndex(name, " #"); i >= 0 {
+		name, suffix = name[:i], name[i:]
+	}
+
+	if strings.HasPrefix(name, "(") && strings.HasSuffix(name, ")") {
+		names := strings.Split(name[1:len(name)-1], ", ")
+		for i, n := range names {
+			names[i] = renameName(n, renames)
+		}
+		return kind + " (" + strings.Join(names, ", ") + ")" + suffix
+	}
+	return kind + " " + renameName(name, renames) + suffix
+}
+
+// renameName renames a declaration, or the receiver of a method like
+// "Foo.String" if only its type was renamed
+func renameName(name string, renames map[string]string) string {
+	if renamed, ok := renames[name]; ok {
+		return renamed
+	}
+	if recv, method, ok := strings.Cut(name, "."); ok {
+		if renamed, ok := renames[recv]; ok {
+			return renamed + "." + method
+		}
+	}
+	return name
+}
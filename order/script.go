@@ -0,0 +1,165 @@
+package order
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"io"
+	"strings"
+)
+
+// Move places the declaration Key right after After, or first if After is
+// empty. Keys are the ones of DeclOrder.
+//
+// Scripts list one move per line:
+//
+//	move func Foo.Bar after type Baz
+//	move const a first
+//
+// Blank lines and lines starting with # are ignored.
+type Move struct {
+	Key   string `json:"key"`
+	After string `json:"after,omitempty"`
+}
+
+func (m Move) String() string {
+	if m.After == "" {
+		return "move " + m.Key + " first"
+	}
+	return "move " + m.Key + " after " + m.After
+}
+
+// Script returns the moves that sort contents. Applied in order, they only
+// move the declarations that sorting does not keep in place. Files that
+// OrderTo leaves alone need no moves.
+func Script(contents []byte, config Config) ([]Move, error) {
+	f, err := prepare(contents, config)
+	if err != nil || f == nil {
+		return nil, err
+	}
+
+	keys := map[ast.Decl]string{}
+	for i, key := range declKeys(f.tree.Decls) {
+		keys[f.tree.Decls[i]] = key
+	}
+
+	before := append([]ast.Decl{}, f.tree.Decls...)
+	if worth, err := f.sort(config); err != nil || !worth {
+		return nil, err
+	}
+	decls := f.tree.Decls
+	moved := movedDecls(before, decls)
+
+	var moves []Move
+	for i, d := range decls {
+		if !moved[d] {
+			continue
+		}
+		m := Move{Key: keys[d]}
+		if i > 0 {
+			m.After = keys[decls[i-1]]
+		}
+		moves = append(moves, m)
+	}
+	return moves, nil
+}
+
+// WriteScript writes moves one per line
+func WriteScript(w io.Writer, moves []Move) error {
+	for _, m := range moves {
+		if _, err := fmt.Fprintln(w, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseScript reads the moves of a script
+func ParseScript(r io.Reader) ([]Move, error) {
+	var moves []Move
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "move ") {
+			return nil, fmt.Errorf("line %d: expected \"move\": %s", n, line)
+		}
+		line = strings.TrimPrefix(line, "move ")
+
+		if strings.HasSuffix(line, " first") {
+			moves = append(moves, Move{Key: strings.TrimSuffix(line, " first")})
+			continue
+		}
+		i := strings.LastIndex(line, " after ")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected \"after <declaration>\" or \"first\": %s", n, line)
+		}
+		moves = append(moves, Move{Key: line[:i], After: line[i+len(" after "):]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read script: %w", err)
+	}
+	return moves, nil
+}
+
+// ApplyScript performs exactly the given moves on contents and writes the
+// result to w, without sorting anything else. The declarations are rewritten
+// like OrderTo does first, and files that OrderTo leaves alone are written
+// unchanged.
+func ApplyScript(w io.Writer, contents []byte, moves []Move, config Config) error {
+	f, err := prepare(contents, config)
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		_, err := w.Write(contents)
+		return err
+	}
+	tree := f.tree
+
+	decls := map[string]ast.Decl{}
+	for i, key := range declKeys(tree.Decls) {
+		decls[key] = tree.Decls[i]
+	}
+
+	for _, m := range moves {
+		m.Key, m.After = renameKey(m.Key, config.Renames), renameKey(m.After, config.Renames)
+		d, ok := decls[m.Key]
+		if !ok {
+			return fmt.Errorf("%s: unknown declaration %s", m, m.Key)
+		}
+		rest := remove(tree.Decls, d)
+
+		to := 0
+		if m.After != "" {
+			after, ok := decls[m.After]
+			if !ok {
+				return fmt.Errorf("%s: unknown declaration %s", m, m.After)
+			}
+			if after == d {
+				return fmt.Errorf("%s: cannot move a declaration after itself", m)
+			}
+			for i, each := range rest {
+				if each == after {
+					to = i + 1
+				}
+			}
+		}
+		tree.Decls = append(rest[:to:to], append([]ast.Decl{d}, rest[to:]...)...)
+	}
+
+	return f.output(w, config)
+}
+
+func remove(decls []ast.Decl, d ast.Decl) []ast.Decl {
+	rest := make([]ast.Decl, 0, len(decls))
+	for _, each := range decls {
+		if each != d {
+			rest = append(rest, each)
+		}
+	}
+	return rest
+}
@@ -0,0 +1,101 @@
+package order
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Shadow is a top level declaration named like an imported package
+type Shadow struct {
+	Line int
+	// Decl is the key of the declaration, e.g. "var http"
+	Decl string
+	// Import is the path of the shadowed package
+	Import string
+}
+
+// Shadows returns the top level declarations of the file named like one of
+// its imported packages, in the order of the file. Packages are assumed to be
+// named after the last element of their path, ignoring major version
+// suffixes like /v2.
+func Shadows(contents []byte) ([]Shadow, error) {
+	fset, tree, _, err := parseFile(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	imported := map[string]string{}
+	for _, spec := range tree.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := importName(p)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if name != "_" && name != "." {
+			imported[name] = p
+		}
+	}
+
+	var shadows []Shadow
+	report := func(kind string, ident *ast.Ident) {
+		if p, ok := imported[ident.Name]; ok {
+			shadows = append(shadows, Shadow{
+				Line:   fset.Position(ident.Pos()).Line,
+				Decl:   kind + " " + ident.Name,
+				Import: p,
+			})
+		}
+	}
+	for _, d := range tree.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				report("func", d.Name)
+			}
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			for _, spec := range d.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					report("type", spec.Name)
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						report(d.Tok.String(), name)
+					}
+				}
+			}
+		}
+	}
+	return shadows, nil
+}
+
+// importName guesses the name of the package imported as p
+func importName(p string) string {
+	name := path.Base(p)
+	if strings.HasPrefix(name, "v") && len(name) > 1 && p != name {
+		if _, err := strconv.Atoi(name[1:]); err == nil {
+			name = path.Base(path.Dir(p))
+		}
+	}
+	return name
+}
+
+// WriteShadows prints the shadows, one per line
+func WriteShadows(w io.Writer, fname string, shadows []Shadow) {
+	if fname == "" {
+		fname = "<stdin>"
+	}
+	for _, s := range shadows {
+		fmt.Fprintf(w, "%s:%d: %s shadows imported package %q\n", fname, s.Line, s.Decl, s.Import)
+	}
+}
@@ -0,0 +1,149 @@
+package order
+
+import (
+	"go/ast"
+	"go/build/constraint"
+	"regexp"
+)
+
+// ignoreDirective opts a file out of sorting, written as
+// "// go-order:ignore" with or without the space
+const ignoreDirective = "go-order:ignore"
+
+// generatedMarker is the comment marking generated files, see
+// https://go.dev/s/generatedcode
+var generatedMarker = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// skipped reports whether the file is left as it is: tools only built with
+// the "ignore" tag, generated code, unless the config includes them, and
+// files opting out with a // go-order:ignore comment
+func skipped(tree *ast.File, config Config) bool {
+	switch {
+	case !config.IncludeIgnored && isIgnored(tree):
+		return true
+	case !config.IncludeGenerated && isGenerated(tree):
+		return true
+	}
+	return hasIgnoreDirective(tree)
+}
+
+// isIgnored reports whether the build constraint of the file can only be
+// satisfied with the "ignore" tag, as is common for standalone generators
+func isIgnored(tree *ast.File) bool {
+	for _, group := range tree.Comments {
+		if group.Pos() >= tree.Package {
+			break
+		}
+		for _, c := range group.List {
+			if !constraint.IsGoBuild(c.Text) && !constraint.IsPlusBuild(c.Text) {
+				continue
+			}
+			expr, err := constraint.Parse(c.Text)
+			if err != nil {
+				continue
+			}
+			if requiresTag(expr, "ignore") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// requiresTag reports whether expr is false for every combination of tags
+// without tag. Expressions with too many tags to try them all are only
+// evaluated with all other tags set.
+func requiresTag(expr constraint.Expr, tag string) bool {
+	var (
+		others []string
+		found  bool
+	)
+	for _, t := range tags(expr) {
+		if t == tag {
+			found = true
+		} else {
+			others = append(others, t)
+		}
+	}
+	if !found {
+		return false
+	}
+	if len(others) > 12 {
+		return !expr.Eval(func(t string) bool { return t != tag })
+	}
+
+	for set := 0; set < 1<<len(others); set++ {
+		satisfied := expr.Eval(func(t string) bool {
+			for i, other := range others {
+				if t == other {
+					return set&(1<<i) != 0
+				}
+			}
+			return false
+		})
+		if satisfied {
+			return false
+		}
+	}
+	return true
+}
+
+// tags returns the distinct tags of expr
+func tags(expr constraint.Expr) []string {
+	var (
+		result []string
+		seen   = map[string]bool{}
+		walk   func(constraint.Expr)
+	)
+	walk = func(expr constraint.Expr) {
+		switch e := expr.(type) {
+		case *constraint.TagExpr:
+			if !seen[e.Tag] {
+				seen[e.Tag] = true
+				result = append(result, e.Tag)
+			}
+		case *constraint.NotExpr:
+			walk(e.X)
+		case *constraint.AndExpr:
+			walk(e.X)
+			walk(e.Y)
+		case *constraint.OrExpr:
+			walk(e.X)
+			walk(e.Y)
+		}
+	}
+	walk(expr)
+	return result
+}
+
+// isGenerated reports whether a line above the package clause marks the
+// file as generated
+func isGenerated(tree *ast.File) bool {
+	for _, group := range tree.Comments {
+		if group.Pos() >= tree.Package {
+			break
+		}
+		for _, c := range group.List {
+			if generatedMarker.MatchString(c.Text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasIgnoreDirective reports whether a // go-order:ignore comment comes before
+// the first declaration, above or below the package clause
+func hasIgnoreDirective(tree *ast.File) bool {
+	for _, group := range tree.Comments {
+		if len(tree.Decls) > 0 && group.Pos() >= tree.Decls[0].Pos() {
+			break
+		}
+		for _, c := range group.List {
+			if isGoOrderDirective(c.Text, ignoreDirective) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,777 @@
+package order
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"regexp"
+	"strings"
+)
+
+// sorter compares declarations of a single file
+type sorter struct {
+	conf Config
+
+	// name of the package of the file
+	pkg string
+
+	// types declared in the file, by name
+	types map[string]*ast.TypeSpec
+
+	// methods declared in the file, by receiver and method name
+	methods map[string]map[string]*ast.FuncDecl
+
+	// names of the functions declared in the file
+	funcs map[string]bool
+
+	// position of a method name in the priority list
+	priority map[string]int
+
+	// compiled Config.PriorityMethodPattern, nil if there is none
+	priorityPattern *regexp.Regexp
+
+	// position of each method in the call order of its receiver's
+	// orchestrating method, see Config.MethodsByCallOrder
+	calls map[*ast.FuncDecl]int
+
+	// position of each function in Config.RouteOrder
+	routes map[string]int
+
+	// compiled patterns of Config.Taxonomy
+	taxonomy [][]*regexp.Regexp
+
+	// position of each doc tag in Config.DocTagOrder
+	tags map[string]int
+
+	// position of each method in the interface its receiver implements,
+	// see Config.ContractMethodsFirst
+	contracts map[string]map[string]int
+
+	// name of the first const of the run of consecutive const declarations
+	// each const using iota belongs to, see indexIotaRuns
+	iotaRuns map[*ast.ValueSpec]string
+
+	// comparators of Config.SortKey
+	sortKey []func(a, b string) int
+
+	// position of the only receiver field each method touches, see
+	// Config.MethodsByField
+	fields map[*ast.FuncDecl]int
+}
+
+func newSorter(t *ast.File, conf Config) (*sorter, error) {
+	s := &sorter{
+		conf:     conf,
+		pkg:      t.Name.Name,
+		types:    map[string]*ast.TypeSpec{},
+		methods:  map[string]map[string]*ast.FuncDecl{},
+		funcs:    map[string]bool{},
+		priority: map[string]int{},
+		calls:    map[*ast.FuncDecl]int{},
+		routes:   map[string]int{},
+		tags:     map[string]int{},
+		fields:   map[*ast.FuncDecl]int{},
+		iotaRuns: map[*ast.ValueSpec]string{},
+	}
+
+	for i, name := range conf.RouteOrder {
+		if _, ok := s.routes[name]; !ok {
+			s.routes[name] = i
+		}
+	}
+
+	for _, tag := range conf.DocTagOrder {
+		tag = strings.Trim(tag, "[]")
+		if _, ok := s.tags[tag]; !ok {
+			s.tags[tag] = len(s.tags)
+		}
+	}
+
+	switch conf.SameNameTiebreak {
+	case "", MethodFirst, FuncFirst:
+	default:
+		return nil, fmt.Errorf("invalid same name tiebreak %q: must be %q or %q", conf.SameNameTiebreak, MethodFirst, FuncFirst)
+	}
+
+	var err error
+	s.taxonomy, err = compileTaxonomy(conf.Taxonomy)
+	if err != nil {
+		return nil, err
+	}
+	s.sortKey, err = compileSortKey(conf.SortKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.PriorityMethodPattern != "" {
+		s.priorityPattern, err = regexp.Compile(conf.PriorityMethodPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid priority method pattern: %w", err)
+		}
+	}
+
+	priority := conf.MethodPriority
+	if priority == nil {
+		priority = DefaultMethodPriority
+	}
+	for i, name := range priority {
+		if _, ok := s.priority[name]; !ok {
+			s.priority[name] = i
+		}
+	}
+
+	for _, d := range t.Decls {
+		switch d := d.(type) {
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				spec := spec.(*ast.TypeSpec)
+				s.types[spec.Name.Name] = spec
+			}
+		case *ast.FuncDecl:
+			f := funcName(d)
+			if f.recv == "" {
+				s.funcs[f.name] = true
+				continue
+			}
+			if s.methods[f.recv] == nil {
+				s.methods[f.recv] = map[string]*ast.FuncDecl{}
+			}
+			s.methods[f.recv][f.name] = d
+		}
+	}
+
+	if conf.ContractMethodsFirst {
+		s.contracts = map[string]map[string]int{}
+		for recv := range s.methods {
+			index := map[string]int{}
+			for i, m := range s.contract(recv) {
+				if _, ok := index[m]; !ok {
+					index[m] = i
+				}
+			}
+			s.contracts[recv] = index
+		}
+	}
+
+	s.indexIotaRuns(t.Decls)
+
+	if conf.MethodsByField {
+		s.indexFields()
+	}
+
+	if conf.MethodsByCallOrder != "" {
+		for _, methods := range s.methods {
+			s.indexCalls(methods, conf.MethodsByCallOrder)
+		}
+	}
+
+	return s, nil
+}
+
+// indexCalls records the order in which the orchestrating method first
+// calls the other methods of its receiver
+func (s *sorter) indexCalls(methods map[string]*ast.FuncDecl, orchestrator string) {
+	orch, ok := methods[orchestrator]
+	if !ok || orch.Body == nil {
+		return
+	}
+
+	var recv string
+	if names := orch.Recv.List[0].Names; len(names) > 0 {
+		recv = names[0].Name
+	}
+	if recv == "" || recv == "_" {
+		return
+	}
+
+	s.calls[orch] = 0
+	ast.Inspect(orch.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); !ok || x.Name != recv {
+			return true
+		}
+		if m, ok := methods[sel.Sel.Name]; ok {
+			if _, seen := s.calls[m]; !seen {
+				s.calls[m] = len(s.calls)
+			}
+		}
+		return true
+	})
+}
+
+// embedded returns the names of the types embedded in the struct type
+// with the given name, limited to types declared in the same file
+func (s *sorter) embedded(name string) []string {
+	spec, ok := s.types[name]
+	if !ok {
+		return nil
+	}
+	st, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		return nil
+	}
+
+	var names []string
+	for _, field := range st.Fields.List {
+		if len(field.Names) > 0 {
+			continue
+		}
+		typ := field.Type
+		if star, ok := typ.(*ast.StarExpr); ok {
+			typ = star.X
+		}
+		if ident, ok := typ.(*ast.Ident); ok {
+			if _, ok := s.types[ident.Name]; ok {
+				names = append(names, ident.Name)
+			}
+		}
+	}
+	return names
+}
+
+func (s *sorter) less(a, b ast.Decl) bool {
+	// sort types first
+	aType, bType := getToken(a), getToken(b)
+	if aType != bType {
+		kinds := order
+		if s.conf.Order != nil {
+			kinds = s.conf.Order
+		}
+		return kinds[aType] < kinds[bType]
+	}
+
+	// then by category of the taxonomy
+	if len(s.taxonomy) > 0 {
+		if ac, bc := s.category(a), s.category(b); ac != bc {
+			return ac < bc
+		}
+	}
+
+	// then by the tag leading the doc comment
+	if len(s.tags) > 0 {
+		if at, bt := s.tagRank(a), s.tagRank(b); at != bt {
+			return at < bt
+		}
+	}
+
+	// two consecutive functions are sorted alphabetically by their name
+	if a, ok := a.(*ast.FuncDecl); ok {
+		if b, ok := b.(*ast.FuncDecl); ok {
+			// init and main go last in any mode
+			if ea, eb := s.entrypoint(a), s.entrypoint(b); ea != eb {
+				return ea < eb
+			}
+			return s.conf.SortAlphabetically && s.lessFuncs(a, b)
+		}
+	}
+
+	// two consecutive general declarations
+	if a, ok := a.(*ast.GenDecl); ok {
+		if b, ok := b.(*ast.GenDecl); ok {
+			// two individual declarations!
+			if len(a.Specs) == 1 && len(b.Specs) == 1 {
+				switch a.Tok {
+				case token.TYPE:
+					return s.lessTypes(a.Specs[0].(*ast.TypeSpec), b.Specs[0].(*ast.TypeSpec))
+				case token.VAR, token.CONST:
+					return s.lessValues(a.Tok, a.Specs[0].(*ast.ValueSpec), b.Specs[0].(*ast.ValueSpec))
+				}
+			}
+		}
+	}
+
+	// keep in the same order
+	return false
+}
+
+func (s *sorter) lessTypes(a, b *ast.TypeSpec) bool {
+	// test doubles sort as the type they stand in for, right after it
+	if s.conf.MocksAfterInterface {
+		am, bm := s.mocked(a), s.mocked(b)
+		if am != nil || bm != nil {
+			ab, bb := a, b
+			if am != nil {
+				ab = am
+			}
+			if bm != nil {
+				bb = bm
+			}
+			if ab != bb {
+				return s.lessTypes(ab, bb)
+			}
+			if (am != nil) != (bm != nil) {
+				return bm != nil
+			}
+			return s.lessName(a.Name.Name, b.Name.Name)
+		}
+	}
+
+	// aliases go after type definitions
+	if s.conf.TypeAliasesLast && a.Assign.IsValid() != b.Assign.IsValid() {
+		return b.Assign.IsValid()
+	}
+
+	// interfaces go before the types implementing them
+	if s.conf.InterfacesFirst {
+		_, ai := a.Type.(*ast.InterfaceType)
+		_, bi := b.Type.(*ast.InterfaceType)
+		if ai != bi {
+			return ai
+		}
+	}
+
+	// types with behavior go before plain data types
+	if s.conf.TypesWithMethodsFirst {
+		am, bm := len(s.methods[a.Name.Name]) > 0, len(s.methods[b.Name.Name]) > 0
+		if am != bm {
+			return am
+		}
+	}
+
+	return s.conf.SortAlphabetically && s.lessIdent(a.Name.Name, b.Name.Name)
+}
+
+func (s *sorter) lessValues(tok token.Token, a, b *ast.ValueSpec) bool {
+	// sentinel errors go first, sorted by name
+	if s.conf.SentinelErrorsFirst {
+		ae, be := isSentinelError(a), isSentinelError(b)
+		if ae != be {
+			return ae
+		}
+		if ae {
+			return s.lessName(a.Names[0].Name, b.Names[0].Name)
+		}
+	}
+
+	// vars are grouped by their type, untyped vars go last
+	if s.conf.GroupVarsByType && tok == token.VAR {
+		if (a.Type != nil) != (b.Type != nil) {
+			return a.Type != nil
+		}
+		if a.Type != nil {
+			if at, bt := types.ExprString(a.Type), types.ExprString(b.Type); at != bt {
+				return strings.Compare(at, bt) < 0
+			}
+		}
+		return s.lessName(a.Names[0].Name, b.Names[0].Name)
+	}
+
+	// consts of a run using iota sort as its first const, in their order
+	an, bn := a.Names[0].Name, b.Names[0].Name
+	ar, aok := s.iotaRuns[a]
+	br, bok := s.iotaRuns[b]
+	if aok {
+		an = ar
+	}
+	if bok {
+		bn = br
+	}
+	if an == bn && (aok || bok) {
+		return a.Pos() < b.Pos()
+	}
+
+	return s.conf.SortAlphabetically && s.lessIdent(an, bn)
+}
+
+// indexIotaRuns finds the runs of consecutive single const declarations of
+// which one uses iota. Such runs are usually one enum split into several
+// declarations, so they keep their order.
+func (s *sorter) indexIotaRuns(decls []ast.Decl) {
+	var run []*ast.ValueSpec
+	flush := func() {
+		found := false
+		for _, spec := range run {
+			for _, v := range spec.Values {
+				found = found || usesIota(v)
+			}
+		}
+		if found {
+			for _, spec := range run {
+				s.iotaRuns[spec] = run[0].Names[0].Name
+			}
+		}
+		run = nil
+	}
+
+	for _, d := range decls {
+		if d, ok := d.(*ast.GenDecl); ok && d.Tok == token.CONST && len(d.Specs) == 1 {
+			run = append(run, d.Specs[0].(*ast.ValueSpec))
+			continue
+		}
+		flush()
+	}
+	flush()
+}
+
+// entrypoint ranks init functions after the other functions and main after
+// init
+func entrypoint(f *ast.FuncDecl) int {
+	if f.Recv != nil {
+		return 0
+	}
+	switch f.Name.Name {
+	case "init":
+		return 1
+	case "main":
+		return 2
+	default:
+		return 0
+	}
+}
+
+// entrypoint ranks functions like entrypoint, except that with
+// Config.MainPackageOrdering init goes before all other functions outside of
+// package main, where main is not special either
+func (s *sorter) entrypoint(f *ast.FuncDecl) int {
+	rank := entrypoint(f)
+	if !s.conf.MainPackageOrdering || s.pkg == "main" {
+		return rank
+	}
+	switch rank {
+	case 1:
+		return -1
+	case 2:
+		return 0
+	}
+	return rank
+}
+
+func (s *sorter) lessFuncs(a, b *ast.FuncDecl) bool {
+	fa, fb := funcName(a), funcName(b)
+	// init and main keep their order, see entrypoint
+	if s.entrypoint(a) != 0 {
+		return false
+	}
+
+	ra, rb := s.sortRecv(fa), s.sortRecv(fb)
+
+	// functions go after methods
+	if ra == "" && rb != "" {
+		return false
+	}
+	if rb == "" && ra != "" {
+		return true
+	}
+
+	// sort methods based on the receiver
+	if ra != rb {
+		return s.lessName(ra, rb)
+	}
+
+	if ra != "" {
+		// a function sharing its name with a method goes right before it
+		if fa.name == fb.name && fa.recv != fb.recv {
+			return fa.recv == ""
+		}
+		return s.lessMethods(a, b, 0)
+	}
+
+	// handlers go first, in the order their routes are registered
+	if less, ok := s.lessRoutes(fa, fb); ok {
+		return less
+	}
+
+	// generic functions go after the others
+	if s.conf.GenericFuncsLast {
+		ag, bg := a.Type.TypeParams != nil, b.Type.TypeParams != nil
+		if ag != bg {
+			return bg
+		}
+	}
+
+	// sort functions alphabetically
+	return s.lessNames(fa, fb)
+}
+
+// lessRoutes compares two functions by their position in Config.RouteOrder,
+// ok is false if neither of them is listed or both are at the same position
+func (s *sorter) lessRoutes(a, b funcOrMethod) (less, ok bool) {
+	ar, aok := s.routes[a.String()]
+	br, bok := s.routes[b.String()]
+	if aok != bok {
+		return aok, true
+	}
+	if aok && ar != br {
+		return ar < br, true
+	}
+	return false, false
+}
+
+// sortRecv returns the receiver whose methods f is sorted with. With the
+// func-first tiebreak, a function sharing its name with a method is sorted
+// with the first such receiver.
+func (s *sorter) sortRecv(f funcOrMethod) string {
+	if f.recv != "" || s.conf.SameNameTiebreak != FuncFirst {
+		return f.recv
+	}
+
+	var recv string
+	for r, methods := range s.methods {
+		if _, ok := methods[f.name]; ok && (recv == "" || r < recv) {
+			recv = r
+		}
+	}
+	return recv
+}
+
+// lessMethods compares two methods of the same receiver. depth guards
+// against cycles when following embedded types.
+func (s *sorter) lessMethods(a, b *ast.FuncDecl, depth int) bool {
+	fa, fb := funcName(a), funcName(b)
+
+	// blank methods, which can never be called, go last
+	if ab, bb := fa.name == "_", fb.name == "_"; ab != bb {
+		return bb
+	}
+
+	// deprecated methods go last
+	if s.conf.DeprecatedMethodsLast {
+		if ad, bd := isDeprecated(a.Doc), isDeprecated(b.Doc); ad != bd {
+			return bd
+		}
+	}
+
+	// lifecycle methods bookend the others
+	if s.conf.BookendMethods {
+		if ab, bb := lifecycle(fa.name), lifecycle(fb.name); ab != bb {
+			return ab < bb
+		}
+	}
+
+	// fluent builder methods go first, in their original order
+	if s.conf.PreserveBuilderOrder {
+		ab, bb := returnsReceiver(a), returnsReceiver(b)
+		if ab != bb {
+			return ab
+		}
+		if ab {
+			return a.Pos() < b.Pos()
+		}
+	}
+
+	// methods of the implemented interface go first, in its order
+	if s.conf.ContractMethodsFirst {
+		ai, aok := s.contracts[fa.recv][fa.name]
+		bi, bok := s.contracts[fb.recv][fb.name]
+		if aok != bok {
+			return aok
+		}
+		if aok && ai != bi {
+			return ai < bi
+		}
+	}
+
+	// overriding methods go first, in the order of the embedded type
+	if s.conf.MirrorEmbeddedOrder && depth <= len(s.types) {
+		ai, ae := s.overridden(fa)
+		bi, be := s.overridden(fb)
+		if (ae != nil) != (be != nil) {
+			return ae != nil
+		}
+		if ae != nil {
+			if ai != bi {
+				return ai < bi
+			}
+			return s.lessMethods(ae, be, depth+1)
+		}
+	}
+
+	// the orchestrating method and the methods it calls go first, in the
+	// order they are called
+	ac, aok := s.calls[a]
+	bc, bok := s.calls[b]
+	if aok != bok {
+		return aok
+	}
+	if aok {
+		return ac < bc
+	}
+
+	// handlers go first, in the order their routes are registered
+	if less, ok := s.lessRoutes(fa, fb); ok {
+		return less
+	}
+
+	// methods touching a single field go first, grouped by that field in
+	// the order of the struct
+	if s.conf.MethodsByField {
+		ai, aok := s.fields[a]
+		bi, bok := s.fields[b]
+		if aok != bok {
+			return aok
+		}
+		if aok && ai != bi {
+			return ai < bi
+		}
+	}
+
+	// methods matching the priority pattern go first, sorted by name
+	if s.priorityPattern != nil {
+		am, bm := s.priorityPattern.MatchString(fa.name), s.priorityPattern.MatchString(fb.name)
+		if am != bm {
+			return am
+		}
+		if am {
+			return s.lessNames(fa, fb)
+		}
+	}
+
+	// methods from the priority list go first, in the order of the list
+	ap, aok := s.priority[fa.name]
+	bp, bok := s.priority[fb.name]
+	if aok != bok {
+		return aok
+	}
+	if aok && ap != bp {
+		return ap < bp
+	}
+
+	return s.lessNames(fa, fb)
+}
+
+// lessIdent compares the names of two types, consts or vars, exported
+// names first with Config.ExportedFirst
+func (s *sorter) lessIdent(a, b string) bool {
+	if s.conf.ExportedFirst {
+		if ae, be := token.IsExported(a), token.IsExported(b); ae != be {
+			return ae
+		}
+	}
+	return s.lessName(a, b)
+}
+
+// lessNames compares two functions or methods by name. With
+// Config.ContextVariantsAdjacent, a XContext variant goes right after X.
+func (s *sorter) lessNames(a, b funcOrMethod) bool {
+	// methods are judged by their own name, not the one of their receiver
+	if s.conf.ExportedFirst {
+		if ae, be := token.IsExported(a.name), token.IsExported(b.name); ae != be {
+			return ae
+		}
+	}
+	if s.conf.ContextVariantsAdjacent {
+		ab, bb := s.contextBase(a), s.contextBase(b)
+		if ab != bb {
+			return s.lessName(ab, bb)
+		}
+		if a.name != b.name {
+			return a.name == ab
+		}
+	}
+	return s.lessName(a.name, b.name)
+}
+
+// contextBase returns X for a XContext function or method if X is declared
+// as well, with the same receiver, and the name of f otherwise
+func (s *sorter) contextBase(f funcOrMethod) string {
+	base := strings.TrimSuffix(f.name, "Context")
+	if base == f.name || base == "" {
+		return f.name
+	}
+	if f.recv == "" && s.funcs[base] || f.recv != "" && s.methods[f.recv][base] != nil {
+		return base
+	}
+	return f.name
+}
+
+// overridden returns the method of an embedded type that m overrides, and
+// the position of that embedded type within the struct
+func (s *sorter) overridden(m funcOrMethod) (int, *ast.FuncDecl) {
+	for i, name := range s.embedded(m.recv) {
+		if d, ok := s.methods[name][m.name]; ok {
+			return i, d
+		}
+	}
+	return -1, nil
+}
+
+// isSentinelError reports whether spec declares an error like
+// ErrNotFound = errors.New("not found")
+func isSentinelError(spec *ast.ValueSpec) bool {
+	if len(spec.Names) != 1 || len(spec.Values) != 1 || !strings.HasPrefix(spec.Names[0].Name, "Err") {
+		return false
+	}
+
+	call, ok := spec.Values[0].(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	return pkg.Name == "errors" && sel.Sel.Name == "New" || pkg.Name == "fmt" && sel.Sel.Name == "Errorf"
+}
+
+// mockPrefixes are the name prefixes of test doubles
+var mockPrefixes = []string{"Mock", "Fake", "Stub"}
+
+// mocked returns the type that spec is a test double for, e.g. Store for
+// MockStore, or nil if spec is not a test double of a type in the file
+func (s *sorter) mocked(spec *ast.TypeSpec) *ast.TypeSpec {
+	for _, prefix := range mockPrefixes {
+		name := strings.TrimPrefix(spec.Name.Name, prefix)
+		if name == spec.Name.Name || name == "" {
+			continue
+		}
+		if typ, ok := s.types[name]; ok && typ != spec {
+			return typ
+		}
+	}
+	return nil
+}
+
+// isDeprecated reports whether doc has a paragraph starting with
+// "Deprecated: ", following the go convention
+func isDeprecated(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, line := range strings.Split(doc.Text(), "\n") {
+		if strings.HasPrefix(line, "Deprecated: ") {
+			return true
+		}
+	}
+	return false
+}
+
+// teardownMethods end the method block with Config.BookendMethods
+var teardownMethods = map[string]bool{"Close": true, "Shutdown": true, "Stop": true}
+
+// lifecycle ranks methods setting their receiver up, such as NewSession,
+// Init, Open or Start, before the other methods and teardown methods after
+func lifecycle(name string) int {
+	switch {
+	case strings.HasPrefix(name, "New") || name == "Init" || name == "Open" || name == "Start":
+		return 0
+	case teardownMethods[name]:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// returnsReceiver reports whether the method f only returns its receiver
+// type, like the methods of a fluent builder
+func returnsReceiver(f *ast.FuncDecl) bool {
+	results := f.Type.Results
+	if f.Recv == nil || results == nil || len(results.List) != 1 || len(results.List[0].Names) > 1 {
+		return false
+	}
+	return types.ExprString(results.List[0].Type) == types.ExprString(f.Recv.List[0].Type)
+}
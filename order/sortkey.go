@@ -0,0 +1,102 @@
+package order
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// comparators are the names usable in Config.SortKey
+var comparators = map[string]func(a, b string) int{
+	"natural":          compareNatural,
+	"case-insensitive": compareFolded,
+	"export":           compareExported,
+}
+
+// compileSortKey looks up the comparators of Config.SortKey
+func compileSortKey(names []string) ([]func(a, b string) int, error) {
+	chain := make([]func(a, b string) int, len(names))
+	for i, name := range names {
+		cmp, ok := comparators[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown sort key %q: must be natural, case-insensitive or export", name)
+		}
+		chain[i] = cmp
+	}
+	return chain, nil
+}
+
+// lessName compares two names with the comparators of Config.SortKey in
+// turn, falling back to comparing their bytes
+func (s *sorter) lessName(a, b string) bool {
+	for _, cmp := range s.sortKey {
+		if c := cmp(a, b); c != 0 {
+			return c < 0
+		}
+	}
+	return strings.Compare(a, b) < 0
+}
+
+// compareNatural compares runs of digits by their value, so that Item2 goes
+// before Item10, and everything else rune by rune
+func compareNatural(a, b string) int {
+	for a != "" && b != "" {
+		ad, bd := leadingDigits(a), leadingDigits(b)
+		if ad != "" && bd != "" {
+			an, bn := strings.TrimLeft(ad, "0"), strings.TrimLeft(bd, "0")
+			if len(an) != len(bn) {
+				return len(an) - len(bn)
+			}
+			if c := strings.Compare(an, bn); c != 0 {
+				return c
+			}
+			a, b = a[len(ad):], b[len(bd):]
+			continue
+		}
+
+		ar, as := utf8.DecodeRuneInString(a)
+		br, bs := utf8.DecodeRuneInString(b)
+		if ar != br {
+			return int(ar) - int(br)
+		}
+		a, b = a[as:], b[bs:]
+	}
+	return len(a) - len(b)
+}
+
+// leadingDigits returns the ASCII digits s starts with
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
+// compareFolded compares a and b ignoring case, including non-ASCII letters
+func compareFolded(a, b string) int {
+	for a != "" && b != "" {
+		ar, as := utf8.DecodeRuneInString(a)
+		br, bs := utf8.DecodeRuneInString(b)
+		if ar, br := unicode.ToLower(ar), unicode.ToLower(br); ar != br {
+			return int(ar) - int(br)
+		}
+		a, b = a[as:], b[bs:]
+	}
+	return len(a) - len(b)
+}
+
+// compareExported orders exported names before unexported ones
+func compareExported(a, b string) int {
+	ae, be := token.IsExported(a), token.IsExported(b)
+	switch {
+	case ae == be:
+		return 0
+	case ae:
+		return -1
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,71 @@
+package order
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+// sourceSpacing returns the number of blank lines to write between two
+// declarations of tree, going by their spacing in the source, see
+// Config.PreserveSpacing. Declarations keep their original positions when
+// sorted, so the source order is the order of their positions.
+func sourceSpacing(fset *token.FileSet, tree *ast.File) func(a, b ast.Decl) int {
+	decls := append([]ast.Decl{}, tree.Decls...)
+	sort.Slice(decls, func(i, j int) bool {
+		return decls[i].Pos() < decls[j].Pos()
+	})
+
+	// blank lines after each declaration and the first declaration of the
+	// run of tightly packed declarations it belongs to
+	after := map[ast.Decl]int{}
+	run := map[ast.Decl]int{}
+	for i, d := range decls {
+		run[d] = i
+		if i > 0 && after[decls[i-1]] == 0 {
+			run[d] = run[decls[i-1]]
+		}
+		if i < len(decls)-1 {
+			after[d] = blankLinesBetween(fset, tree, d, decls[i+1])
+		}
+	}
+
+	// the run following each run, with the blank lines between them
+	next := map[int]int{}
+	between := map[int]int{}
+	for i := 1; i < len(decls); i++ {
+		prev, d := decls[i-1], decls[i]
+		if run[prev] != run[d] {
+			next[run[prev]] = run[d]
+			between[run[prev]] = after[prev]
+		}
+	}
+
+	return func(a, b ast.Decl) int {
+		if run[a] == run[b] {
+			return 0
+		}
+		if n, ok := next[run[a]]; ok && n == run[b] {
+			return between[run[a]]
+		}
+		return 1
+	}
+}
+
+// blankLinesBetween returns the number of blank lines between the end of the
+// line of a and b, or the first comment above b
+func blankLinesBetween(fset *token.FileSet, tree *ast.File, a, b ast.Decl) int {
+	end := fset.Position(a.End()).Line
+	start := fset.Position(b.Pos()).Line
+	for _, c := range tree.Comments {
+		line := fset.Position(c.Pos()).Line
+		if c.Pos() >= a.End() && c.End() <= b.Pos() && line > end {
+			start = line
+			break
+		}
+	}
+	if start-end-1 < 0 {
+		return 0
+	}
+	return start - end - 1
+}
@@ -0,0 +1,63 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// checkReceivers reports the types whose methods do not all use the same
+// receiver name
+func checkReceivers(fset *token.FileSet, tree *ast.File) error {
+	type use struct {
+		name string
+		line int
+	}
+
+	var (
+		recvs []string
+		uses  = map[string][]use{}
+	)
+	for _, d := range tree.Decls {
+		f, ok := d.(*ast.FuncDecl)
+		if !ok || f.Recv == nil || len(f.Recv.List) == 0 {
+			continue
+		}
+		names := f.Recv.List[0].Names
+		if len(names) == 0 || names[0].Name == "_" {
+			continue
+		}
+
+		recv := funcName(f).recv
+		if _, ok := uses[recv]; !ok {
+			recvs = append(recvs, recv)
+		}
+		uses[recv] = append(uses[recv], use{name: names[0].Name, line: fset.Position(names[0].Pos()).Line})
+	}
+	sort.Strings(recvs)
+
+	var problems []string
+	for _, recv := range recvs {
+		var (
+			seen      = map[string]bool{}
+			conflicts []string
+		)
+		for _, u := range uses[recv] {
+			if !seen[u.name] {
+				seen[u.name] = true
+				conflicts = append(conflicts, fmt.Sprintf("%s (line %d)", u.name, u.line))
+			}
+		}
+		if len(conflicts) > 1 {
+			problems = append(problems, fmt.Sprintf("inconsistent receiver names for %s: %s", recv, strings.Join(conflicts, ", ")))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n"))
+	}
+	return nil
+}
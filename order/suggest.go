@@ -0,0 +1,84 @@
+package order
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// suggestionContext is the number of unchanged lines that still join two
+// changed regions into a single suggestion
+const suggestionContext = 2
+
+// Suggestion replaces the lines Start to End, 1-indexed and inclusive, of
+// the original file with Text
+type Suggestion struct {
+	Start, End int
+	Text       string
+}
+
+// Suggestions returns the replacements turning contents into its sorted
+// form, one per out of order region
+func Suggestions(contents []byte, config Config) ([]Suggestion, error) {
+	var buf bytes.Buffer
+	if err := OrderTo(&buf, contents, config); err != nil {
+		return nil, err
+	}
+	before, after := splitLines(contents), splitLines(buf.Bytes())
+
+	// drop what both share at the start and end
+	prefix := 0
+	for prefix < len(before) && prefix < len(after) && before[prefix] == after[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(before)-prefix && suffix < len(after)-prefix &&
+		before[len(before)-1-suffix] == after[len(after)-1-suffix] {
+		suffix++
+	}
+	if prefix == len(before) && prefix == len(after) {
+		return nil, nil
+	}
+
+	// lines can only be compared one by one if sorting moved them around
+	// without adding or removing any, e.g. when formatting
+	if len(before) != len(after) {
+		return []Suggestion{{
+			Start: prefix + 1,
+			End:   len(before) - suffix,
+			Text:  strings.Join(after[prefix:len(after)-suffix], "\n"),
+		}}, nil
+	}
+
+	var result []Suggestion
+	for i := prefix; i < len(before)-suffix; i++ {
+		if before[i] == after[i] {
+			continue
+		}
+		if n := len(result); n > 0 && i-result[n-1].End <= suggestionContext {
+			result[n-1].End = i + 1
+		} else {
+			result = append(result, Suggestion{Start: i + 1, End: i + 1})
+		}
+	}
+	for i := range result {
+		result[i].Text = strings.Join(after[result[i].Start-1:result[i].End], "\n")
+	}
+	return result, nil
+}
+
+func splitLines(b []byte) []string {
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+// WriteSuggestions writes each suggestion as a GitHub review suggestion
+// block, preceded by the file and lines it applies to
+func WriteSuggestions(w io.Writer, fname string, suggestions []Suggestion) {
+	if fname == "" {
+		fname = "<stdin>"
+	}
+	for _, s := range suggestions {
+		fmt.Fprintf(w, "%s:%d-%d\n```suggestion\n%s\n```\n", fname, s.Start, s.End, s.Text)
+	}
+}
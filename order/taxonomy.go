@@ -0,0 +1,88 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"io"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Category groups the declarations whose name matches any of its patterns
+type Category struct {
+	Name     string   `yaml:"name"`
+	Patterns []string `yaml:"patterns"`
+}
+
+// ParseTaxonomy reads a list of categories, in the order they should appear
+// in the file, from YAML like:
+//
+//	categories:
+//	  - name: handlers
+//	    patterns: ["^handle"]
+//	  - name: helpers
+//	    patterns: ["."]
+func ParseTaxonomy(r io.Reader) ([]Category, error) {
+	var taxonomy struct {
+		Categories []Category `yaml:"categories"`
+	}
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&taxonomy); err != nil {
+		return nil, fmt.Errorf("failed to parse taxonomy: %w", err)
+	}
+
+	if len(taxonomy.Categories) == 0 {
+		return nil, errors.New("taxonomy has no categories")
+	}
+	if _, err := compileTaxonomy(taxonomy.Categories); err != nil {
+		return nil, err
+	}
+	return taxonomy.Categories, nil
+}
+
+// compileTaxonomy validates the categories and compiles their patterns
+func compileTaxonomy(categories []Category) ([][]*regexp.Regexp, error) {
+	seen := map[string]bool{}
+	compiled := make([][]*regexp.Regexp, len(categories))
+	for i, c := range categories {
+		if c.Name == "" {
+			return nil, fmt.Errorf("category %d has no name", i+1)
+		}
+		if seen[c.Name] {
+			return nil, fmt.Errorf("category %q is defined twice", c.Name)
+		}
+		seen[c.Name] = true
+
+		if len(c.Patterns) == 0 {
+			return nil, fmt.Errorf("category %q has no patterns", c.Name)
+		}
+		for _, p := range c.Patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("category %q: invalid pattern: %w", c.Name, err)
+			}
+			compiled[i] = append(compiled[i], re)
+		}
+	}
+	return compiled, nil
+}
+
+// category returns the position of the first category matching the name of
+// d, or len(categories) if none match
+func (s *sorter) category(d ast.Decl) int {
+	key := declKey(d)
+	// drop the kind, e.g. "func Foo.String" becomes "Foo.String"
+	name := key[strings.IndexByte(key, ' ')+1:]
+	for i, patterns := range s.taxonomy {
+		for _, re := range patterns {
+			if re.MatchString(name) {
+				return i
+			}
+		}
+	}
+	return len(s.taxonomy)
+}
@@ -0,0 +1,72 @@
+package order
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// placeholder matches template actions such as {{ .Name }}
+var placeholder = regexp.MustCompile(`\{\{.*?\}\}`)
+
+// placeholderLine replaces lines made of template actions only. Being a
+// barrier, declarations are never moved across it.
+const placeholderLine = barrierDirective + " template line "
+
+// sortTemplate sorts a go file containing template placeholders, such as a
+// .go.tmpl file. Lines holding nothing but placeholders stay where they are
+// and declarations are only sorted between them. Placeholders within a line
+// move along with their declaration.
+func sortTemplate(contents []byte, w io.Writer, config Config) error {
+	var (
+		lines    = bytes.SplitAfter(contents, []byte("\n"))
+		original [][]byte
+		inline   [][]byte
+	)
+	for i, line := range lines {
+		if !bytes.Contains(line, []byte("{{")) {
+			continue
+		}
+
+		// actions spanning several lines are opaque as a whole
+		if !placeholder.Match(line) || len(bytes.TrimSpace(placeholder.ReplaceAll(line, nil))) == 0 {
+			nl := line[len(bytes.TrimRight(line, "\n")):]
+			lines[i] = append([]byte(placeholderLine+strconv.Itoa(len(original))), nl...)
+			original = append(original, line)
+			continue
+		}
+
+		lines[i] = placeholder.ReplaceAllFunc(line, func(action []byte) []byte {
+			inline = append(inline, action)
+			return []byte(fmt.Sprintf("__placeholder%d__", len(inline)-1))
+		})
+	}
+
+	config.TemplateMode = false
+	var buf bytes.Buffer
+	if err := OrderTo(&buf, bytes.Join(lines, nil), config); err != nil {
+		return fmt.Errorf("template mode: %w", err)
+	}
+
+	// put the placeholders back
+	lines = bytes.SplitAfter(buf.Bytes(), []byte("\n"))
+	for i, line := range lines {
+		trimmed := bytes.TrimSpace(line)
+		if bytes.HasPrefix(trimmed, []byte(placeholderLine)) {
+			n, err := strconv.Atoi(string(bytes.TrimPrefix(trimmed, []byte(placeholderLine))))
+			if err == nil && n < len(original) {
+				nl := line[len(bytes.TrimRight(line, "\n")):]
+				lines[i] = append(bytes.TrimRight(original[n], "\n"), nl...)
+				continue
+			}
+		}
+		for n, action := range inline {
+			lines[i] = bytes.ReplaceAll(lines[i], []byte(fmt.Sprintf("__placeholder%d__", n)), action)
+		}
+	}
+
+	_, err := w.Write(bytes.Join(lines, nil))
+	return err
+}
@@ -0,0 +1,132 @@
+package order
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// groupWithTypes moves functions right below the declaration of the type
+// they belong to: constructors like NewFoo if constructors is set, followed
+// by the methods if methods is set. Constructors are sorted by name, methods
+// keep their sorted order. Functions of types declared elsewhere stay where
+// they are. With methods, the const block of an enum with a String method
+// follows its type, right above the String method.
+func groupWithTypes(decls []ast.Decl, constructors, methods bool) {
+	types := map[string]ast.Decl{}
+	for _, d := range decls {
+		if d, ok := d.(*ast.GenDecl); ok && d.Tok == token.TYPE {
+			for _, spec := range d.Specs {
+				types[spec.(*ast.TypeSpec).Name.Name] = d
+			}
+		}
+	}
+
+	ctors := map[ast.Decl][]*ast.FuncDecl{}
+	funcs := map[ast.Decl][]ast.Decl{}
+	grouped := map[ast.Decl]bool{}
+	for _, d := range decls {
+		f, ok := d.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		if recv := funcName(f).recv; recv != "" {
+			if typ, ok := types[recv]; ok && methods {
+				funcs[typ] = append(funcs[typ], f)
+				grouped[f] = true
+			}
+			continue
+		}
+		if typ := constructed(f, types); typ != nil && constructors {
+			ctors[typ] = append(ctors[typ], f)
+			grouped[f] = true
+		}
+	}
+
+	enums := map[string][]ast.Decl{}
+	if methods {
+		for _, d := range decls {
+			typ := enumType(d)
+			if typ != "" && stringMethod(funcs[types[typ]], typ) >= 0 {
+				enums[typ] = append(enums[typ], d)
+				grouped[d] = true
+			}
+		}
+	}
+	if len(grouped) == 0 {
+		return
+	}
+
+	result := make([]ast.Decl, 0, len(decls))
+	for _, d := range decls {
+		if grouped[d] {
+			continue
+		}
+		result = append(result, d)
+
+		if g, ok := d.(*ast.GenDecl); ok && g.Tok == token.TYPE {
+			for _, spec := range g.Specs {
+				typ := spec.(*ast.TypeSpec).Name.Name
+				if len(enums[typ]) == 0 {
+					continue
+				}
+				i := stringMethod(funcs[d], typ)
+				result = append(result, enums[typ]...)
+				result = append(result, funcs[d][i])
+				funcs[d] = append(funcs[d][:i:i], funcs[d][i+1:]...)
+			}
+		}
+		sort.SliceStable(ctors[d], func(i, j int) bool {
+			return ctors[d][i].Name.Name < ctors[d][j].Name.Name
+		})
+		for _, f := range ctors[d] {
+			result = append(result, f)
+		}
+		result = append(result, funcs[d]...)
+	}
+	copy(decls, result)
+}
+
+// constructed returns the declaration of the type that f constructs, going
+// by its name: NewFoo or newFoo construct Foo, newFoo also constructs foo
+func constructed(f *ast.FuncDecl, types map[string]ast.Decl) ast.Decl {
+	name := f.Name.Name
+	for _, prefix := range []string{"New", "new"} {
+		typ := strings.TrimPrefix(name, prefix)
+		if typ == name || typ == "" {
+			continue
+		}
+		if d, ok := types[typ]; ok {
+			return d
+		}
+		if d, ok := types[lowerFirst(typ)]; ok && prefix == "new" {
+			return d
+		}
+	}
+	return nil
+}
+
+// enumType returns the name of the type of the enum declared by the const
+// block d, going by the type of its first constant, or "" if d is not one
+func enumType(d ast.Decl) string {
+	g, ok := d.(*ast.GenDecl)
+	if !ok || g.Tok != token.CONST || !g.Lparen.IsValid() || len(g.Specs) == 0 {
+		return ""
+	}
+	if ident, ok := g.Specs[0].(*ast.ValueSpec).Type.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// stringMethod returns the index of the String method of typ among methods,
+// -1 if there is none
+func stringMethod(methods []ast.Decl, typ string) int {
+	for i, d := range methods {
+		if f := funcName(d.(*ast.FuncDecl)); f.recv == typ && f.name == "String" {
+			return i
+		}
+	}
+	return -1
+}
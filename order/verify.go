@@ -0,0 +1,80 @@
+package order
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+)
+
+// VerifyDecls checks that sorting only moved declarations around: every
+// declaration of the original, as rewritten by the options that rewrite
+// declarations on purpose, must be found in sorted with identical content,
+// ignoring surrounding whitespace
+func VerifyDecls(original, sorted []byte, config Config) error {
+	f, err := prepare(original, config)
+	if err != nil {
+		return err
+	}
+	if f != nil {
+		original = f.contents
+	}
+
+	before, err := declContents(original, config)
+	if err != nil {
+		return err
+	}
+	after, err := declContents(sorted, config)
+	if err != nil {
+		return fmt.Errorf("sorted output is invalid: %w", err)
+	}
+
+	for _, key := range before.keys {
+		if _, ok := before.text[key]; !ok {
+			continue
+		}
+		text, ok := after.text[key]
+		if !ok {
+			return fmt.Errorf("declaration %s is missing from the sorted output", key)
+		}
+		if !bytes.Equal(text, before.text[key]) {
+			return fmt.Errorf("content of declaration %s changed while sorting", key)
+		}
+	}
+	for _, key := range after.keys {
+		if _, ok := after.text[key]; !ok {
+			continue
+		}
+		if _, ok := before.text[key]; !ok {
+			return fmt.Errorf("declaration %s appeared while sorting", key)
+		}
+	}
+	return nil
+}
+
+type declTexts struct {
+	keys []string
+	text map[string][]byte
+}
+
+// declContents returns the trimmed source of every declaration by key
+func declContents(src []byte, config Config) (declTexts, error) {
+	_, tree, _, err := parseFile(src)
+	if err != nil {
+		return declTexts{}, err
+	}
+
+	c := declTexts{
+		keys: declKeys(tree.Decls),
+		text: map[string][]byte{},
+	}
+	for i, d := range tree.Decls {
+		text := bytes.TrimSpace(src[d.Pos()-1 : d.End()-1])
+		if config.Gofmt {
+			if formatted, err := format.Source(text); err == nil {
+				text = bytes.TrimSpace(formatted)
+			}
+		}
+		c.text[c.keys[i]] = text
+	}
+	return c, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/td0m/go-order/order"
+)
+
+// plan holds the moves sorting each file of a tree, written by -plan-out
+// and performed later by -apply-plan
+type plan struct {
+	Files []plannedFile `json:"files"`
+}
+
+type plannedFile struct {
+	Path string `json:"path"`
+	// SHA256 is the hash of the contents the moves were planned for
+	SHA256 string       `json:"sha256"`
+	Moves  []order.Move `json:"moves"`
+}
+
+// hashContents returns the hex encoded SHA256 of contents
+func hashContents(contents []byte) string {
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
+
+// writePlan writes the plan sorting every go file below root, which may
+// also be a single file, to w. Files that are already sorted are left out.
+func writePlan(w io.Writer, root string, config order.Config) error {
+	p := plan{Files: []plannedFile{}}
+	err := walkGoFiles(root, func(fname string) error {
+		contents, err := os.ReadFile(fname)
+		if err != nil {
+			return fmt.Errorf("failed to read from file: %w", err)
+		}
+		moves, err := order.Script(contents, config)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fname, err)
+		}
+		if len(moves) > 0 {
+			p.Files = append(p.Files, plannedFile{Path: fname, SHA256: hashContents(contents), Moves: moves})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// applyPlan performs the moves of the plan in r, writing the files in place.
+// Files changed since the plan was made are skipped with a warning to
+// stderr.
+func applyPlan(r io.Reader, stderr io.Writer, config order.Config) error {
+	var p plan
+	if err := json.NewDecoder(r).Decode(&p); err != nil {
+		return fmt.Errorf("failed to parse plan: %w", err)
+	}
+
+	skipped := 0
+	for _, f := range p.Files {
+		contents, err := os.ReadFile(f.Path)
+		if err != nil {
+			return fmt.Errorf("failed to read from file: %w", err)
+		}
+		if hashContents(contents) != f.SHA256 {
+			fmt.Fprintf(stderr, "%s: changed since the plan was made, skipping\n", f.Path)
+			skipped++
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := order.ApplyScript(&buf, contents, f.Moves, config); err != nil {
+			return fmt.Errorf("%s: %w", f.Path, err)
+		}
+		if err := replaceFile(f.Path, contents, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	if skipped > 0 {
+		return fmt.Errorf("skipped %d changed files", skipped)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/td0m/go-order/order"
+)
+
+// walkGoFiles calls fn for every .go file below root. Directories the go
+// tool ignores, such as testdata and vendor, are skipped.
+func walkGoFiles(root string, fn func(fname string) error) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if p != root && (name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(p) != ".go" {
+			return nil
+		}
+		return fn(p)
+	})
+}
+
+// outputMode decides what is printed instead of the sorted file
+type outputMode int
+
+const (
+	printSorted outputMode = iota
+	// -l
+	listUnsorted
+	// -d
+	printDiff
+	// -check
+	checkSorted
+	// -format=patch
+	printPatch
+)
+
+// sortTree sorts every go file below root like sortFiles
+func sortTree(root string, stdout, stderr io.Writer, config order.Config, tests bool, mode outputMode, jobs int) error {
+	var fnames []string
+	err := walkGoFiles(root, func(fname string) error {
+		fnames = append(fnames, fname)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return sortFiles(fnames, stdout, stderr, config, tests, mode, jobs)
+}
+
+// sortFiles sorts each of fnames, writing it back with -w or to stdout
+// otherwise, depending on mode. Up to jobs files are sorted at once, their
+// output and errors are reported in the order of fnames once all are done.
+// A file failing to sort does not stop the others. With -check the unsorted
+// files are listed on stderr and errUnsorted is returned if there are any.
+func sortFiles(fnames []string, stdout, stderr io.Writer, config order.Config, tests bool, mode outputMode, jobs int) error {
+	// running the tests of a package while another file of it is being
+	// sorted could restore the wrong contents
+	if jobs < 1 || tests {
+		jobs = 1
+	}
+
+	type result struct {
+		out bytes.Buffer
+		err error
+	}
+	results := make([]result, len(fnames))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i].err = sortPath(fnames[i], &results[i].out, config, tests, mode)
+			}
+		}()
+	}
+	for i := range fnames {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	failed, unsorted := 0, 0
+	for i, fname := range fnames {
+		if _, err := stdout.Write(results[i].out.Bytes()); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		if err := results[i].err; errors.Is(err, errUnsorted) {
+			fmt.Fprintln(stderr, fname)
+			unsorted++
+		} else if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", fname, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to sort %d files", failed)
+	}
+	if unsorted > 0 {
+		return errUnsorted
+	}
+	return nil
+}
+
+// sortPath sorts a single file of a walk or of the arguments
+func sortPath(fname string, stdout io.Writer, config order.Config, tests bool, mode outputMode) error {
+	contents, err := os.ReadFile(fname)
+	if err != nil {
+		return fmt.Errorf("failed to read from file: %w", err)
+	}
+	return sortContents(fname, contents, stdout, config, tests, mode)
+}
+
+// sortContents sorts the contents of fname, which is empty for stdin
+func sortContents(fname string, contents []byte, stdout io.Writer, config order.Config, tests bool, mode outputMode) error {
+	switch mode {
+	case listUnsorted:
+		unsorted, err := needsSorting(contents, config)
+		if err != nil {
+			return err
+		}
+		if unsorted {
+			if fname == "" {
+				return errUnsorted
+			}
+			fmt.Fprintln(stdout, fname)
+		}
+		return nil
+	case checkSorted:
+		unsorted, err := needsSorting(contents, config)
+		if err != nil {
+			return err
+		}
+		if unsorted {
+			return errUnsorted
+		}
+		return nil
+	case printDiff, printPatch:
+		var buf bytes.Buffer
+		if err := order.OrderTo(&buf, contents, config); err != nil {
+			return fmt.Errorf("sortFile failed: %w", err)
+		}
+		if fname == "" {
+			fname = "<stdin>"
+		}
+		diff := unifiedDiff(fname, fname, contents, buf.Bytes())
+		if mode == printPatch {
+			diff = gitPatch(fname, contents, buf.Bytes())
+		}
+		_, err := stdout.Write(diff)
+		return err
+	}
+
+	if config.WriteToFile {
+		if tests {
+			return writeFileTested(fname, contents, config)
+		}
+		return writeFile(fname, contents, config)
+	}
+
+	bw := bufio.NewWriter(stdout)
+	if err := order.OrderTo(bw, contents, config); err != nil {
+		return fmt.Errorf("sortFile failed: %w", err)
+	}
+	return bw.Flush()
+}
+
+// needsSorting reports whether sorting would change contents
+func needsSorting(contents []byte, config order.Config) (bool, error) {
+	var buf bytes.Buffer
+	if err := order.OrderTo(&buf, contents, config); err != nil {
+		return false, fmt.Errorf("sortFile failed: %w", err)
+	}
+	return !bytes.Equal(buf.Bytes(), contents), nil
+}